@@ -0,0 +1,109 @@
+package bufferpool
+
+import "fmt"
+
+// ErrKind categorizes what went wrong, so callers can decide whether to
+// retry, roll back a Tx, or give up without needing to string-match
+// Error.Error().
+type ErrKind int
+
+const (
+	// ErrNotFound - the requested frame/page isn't known to the pool.
+	ErrNotFound ErrKind = iota
+	// ErrOutOfRange - an index fell outside what the pool currently holds.
+	ErrOutOfRange
+	// ErrEvictionFailed - the evictor couldn't produce a usable victim.
+	ErrEvictionFailed
+	// ErrIncoherentState - an internal invariant the pool relies on (e.g.
+	// frame2Buf/buf2Frame agreeing with the lru) didn't hold.
+	ErrIncoherentState
+	// ErrIO - the backing FramePool/Storage failed to read or write.
+	ErrIO
+	// ErrClosed - the pool (or its backing resource) is no longer usable.
+	ErrClosed
+	// ErrReadOnly - a write was attempted against something opened read-only.
+	ErrReadOnly
+)
+
+func (k ErrKind) String() string {
+	switch k {
+	case ErrNotFound:
+		return "not found"
+	case ErrOutOfRange:
+		return "out of range"
+	case ErrEvictionFailed:
+		return "eviction failed"
+	case ErrIncoherentState:
+		return "incoherent state"
+	case ErrIO:
+		return "I/O error"
+	case ErrClosed:
+		return "closed"
+	case ErrReadOnly:
+		return "read-only"
+	default:
+		return fmt.Sprintf("unknown error kind (%d)", int(k))
+	}
+}
+
+// Error is the structured error type returned for the failures MockPool,
+// DiskPool's ReadFrame/WriteFrame, BufferPool's page methods and the
+// evictors detect themselves, so callers can use errors.As to recover
+// which operation failed, what kind of failure it was, which frame (if
+// any) was involved, and the underlying cause (if any) via errors.Is/As
+// on Unwrap. Errors passed straight up from a backing FramePool or
+// Storage, and those of MmapPool, WALPool, the Storage implementations,
+// Tx and Slab, are plain errors, not *Error.
+type Error struct {
+	// Op is the method that failed, e.g. "DiskPool.ReadFrame".
+	Op string
+	// Kind categorizes the failure; match against the sentinel ErrXxx
+	// values with errors.Is.
+	Kind ErrKind
+	// FrameID is the frame involved, or -1 if none is applicable.
+	FrameID int
+	// Cause is the underlying error, if any.
+	Cause error
+}
+
+func newError(op string, kind ErrKind, frameID int, cause error) *Error {
+	return &Error{Op: op, Kind: kind, FrameID: frameID, Cause: cause}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("bufferpool: %s: %s", e.Op, e.Kind)
+	if e.FrameID >= 0 {
+		msg += fmt.Sprintf(" (frame %d)", e.FrameID)
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap exposes Cause to errors.Is/As.
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is lets errors.Is(err, ErrNotFound) (and the other sentinels below)
+// match any *Error of that Kind, regardless of Op/FrameID/Cause.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Kind == t.Kind
+}
+
+// Sentinel values for errors.Is. Each only carries a Kind, so matching
+// ignores Op/FrameID/Cause - see Error.Is.
+var (
+	ErrFrameNotFound   = &Error{Kind: ErrNotFound, FrameID: -1}
+	ErrIndexOutOfRange = &Error{Kind: ErrOutOfRange, FrameID: -1}
+	ErrEviction        = &Error{Kind: ErrEvictionFailed, FrameID: -1}
+	ErrIncoherent      = &Error{Kind: ErrIncoherentState, FrameID: -1}
+	ErrIOFailure       = &Error{Kind: ErrIO, FrameID: -1}
+	ErrPoolClosed      = &Error{Kind: ErrClosed, FrameID: -1}
+	ErrPoolReadOnly    = &Error{Kind: ErrReadOnly, FrameID: -1}
+)
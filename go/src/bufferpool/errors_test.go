@@ -0,0 +1,35 @@
+package bufferpool
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_IsMatchesByKindOnly(t *testing.T) {
+	err := newError("DiskPool.ReadFrame", ErrNotFound, 7, fmt.Errorf("boom"))
+	assert.True(t, errors.Is(err, ErrFrameNotFound))
+	assert.False(t, errors.Is(err, ErrIndexOutOfRange))
+}
+
+func TestError_UnwrapExposesCause(t *testing.T) {
+	cause := fmt.Errorf("underlying failure")
+	err := newError("DiskPool.WriteFrame", ErrIO, 3, cause)
+	assert.Equal(t, cause, errors.Unwrap(err))
+	assert.True(t, errors.Is(err, ErrIOFailure))
+}
+
+func TestError_AsRecoversFields(t *testing.T) {
+	err := newError("BufferPool.GetPage", ErrOutOfRange, 42, nil)
+	var got *Error
+	assert.True(t, errors.As(err, &got))
+	assert.Equal(t, "BufferPool.GetPage", got.Op)
+	assert.Equal(t, 42, got.FrameID)
+}
+
+func TestError_MessageOmitsFrameIDWhenNegative(t *testing.T) {
+	err := newError("BottomEvictor.Evict", ErrEvictionFailed, -1, nil)
+	assert.NotContains(t, err.Error(), "frame")
+}
@@ -3,13 +3,10 @@ package bufferpool
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
-	"io/ioutil"
-	"log"
 	"math/rand"
-	"os"
 	"path"
-	"strings"
 	"sync"
 )
 
@@ -67,7 +64,7 @@ func (o *MockPool) ReadFrame(idx int) (*PageFrame, error) {
 	defer o.m.RUnlock()
 	val, ok := o.frames[idx]
 	if !ok {
-		return nil, fmt.Errorf("%d not in framePool", idx)
+		return nil, newError("MockPool.ReadFrame", ErrNotFound, idx, nil)
 	}
 	return val, nil
 }
@@ -96,26 +93,34 @@ type DiskPool struct {
 	loadedFrames   map[int]*PageFrame
 	knownPageCount int
 	path           string
-	m              sync.RWMutex
+	// storage is where pages actually live; DiskPool itself only knows
+	// about TypePage FileDescs and page_%d naming, not the directory
+	// layout that backs them.
+	storage Storage
+	// m guards knownPageCount and serializes the storage writes in
+	// Falloc/WriteFrame, so concurrent callers (e.g. Slab) can't race on
+	// the page count or interleave file creation with a write.
+	m sync.RWMutex
 }
 
 // NewDiskPool locates the directory path; if the directory doesn't
 // exist, error.  Then, Falloc is called on limit, which will ensure
 // at least `limit` frames are created. If those frames exist already,
-// they are not recreated.
+// they are not recreated. Pages are read and written through a
+// FileStorage, so callers who need a different backing medium (S3,
+// tmpfs, a fault-injecting test double) can build their own Storage and
+// talk to it directly instead of reimplementing DiskPool.
 func NewDiskPool(limit int, directoryPath string) (*DiskPool, error) {
-	s, err := os.Stat(directoryPath)
+	storage, err := NewFileStorage(directoryPath)
 	if err != nil {
 		return nil, err
 	}
-	if !s.IsDir() {
-		return nil, fmt.Errorf("%s is not a directory", directoryPath)
-	}
 
 	dp := &DiskPool{
 		loadedFrames:   map[int]*PageFrame{},
 		knownPageCount: 0,
 		path:           directoryPath,
+		storage:        storage,
 	}
 	err = dp.Falloc(limit)
 	if err != nil {
@@ -125,22 +130,19 @@ func NewDiskPool(limit int, directoryPath string) (*DiskPool, error) {
 }
 
 func (o *DiskPool) Size() int {
+	o.m.RLock()
+	defer o.m.RUnlock()
 	return o.knownPageCount
 }
 
 func (o *DiskPool) AssessSize() (int, error) {
-	files, err := ioutil.ReadDir(o.path)
+	descs, err := o.storage.List(TypePage)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
-
-	count := 0
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "page_") {
-			count++
-		}
-	}
-	o.knownPageCount = count
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.knownPageCount = len(descs)
 	return o.knownPageCount, nil
 }
 
@@ -151,49 +153,62 @@ func (o *DiskPool) PageFileName(idx int) string {
 
 // Falloc creates `limit` more frames in the DiskPool directory.
 func (o *DiskPool) Falloc(limit int) error {
+	o.m.Lock()
+	defer o.m.Unlock()
 	priorSize := o.knownPageCount
 	for i := 0; i < limit; i++ {
-		pageId := priorSize + i
-		filename := o.PageFileName(pageId)
-		fh, err := os.Open(filename)
+		desc := FileDesc{Type: TypePage, Num: priorSize + i}
+		r, err := o.storage.Open(desc)
 		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				err := os.WriteFile(filename, []byte{}, 0600)
-				if err != nil {
-					return err
-				}
-			} else {
+			if !errors.Is(err, fs.ErrNotExist) {
 				return err
 			}
-
+			w, err := o.storage.Create(desc)
+			if err != nil {
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+			continue
 		}
-		_ = fh.Close()
+		_ = r.Close()
 	}
 	o.knownPageCount += limit
 	return nil
 }
 func (o *DiskPool) ReadFrame(idx int) (*PageFrame, error) {
-	if idx > o.knownPageCount {
-		return nil, fmt.Errorf("frame index too large: %d", idx)
+	o.m.RLock()
+	tooFar := idx > o.knownPageCount
+	o.m.RUnlock()
+	if tooFar {
+		return nil, newError("DiskPool.ReadFrame", ErrOutOfRange, idx, nil)
 	}
-	filename := o.PageFileName(idx)
-	b, err := os.ReadFile(filename)
+	r, err := o.storage.Open(FileDesc{Type: TypePage, Num: idx})
 	if err != nil {
-		return nil, err
+		return nil, newError("DiskPool.ReadFrame", ErrIO, idx, err)
+	}
+	defer func() { _ = r.Close() }()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, newError("DiskPool.ReadFrame", ErrIO, idx, err)
 	}
 	return NewPageFrame(b), nil
 }
 
 func (o *DiskPool) WriteFrame(idx int, pf *PageFrame) error {
-	if idx > o.knownPageCount {
-		return fmt.Errorf("frame index too large: %d", idx)
-	}
 	o.m.Lock()
 	defer o.m.Unlock()
-	filename := o.PageFileName(idx)
-	err := os.WriteFile(filename, pf.frame, 0600)
+	if idx > o.knownPageCount {
+		return newError("DiskPool.WriteFrame", ErrOutOfRange, idx, nil)
+	}
+	w, err := o.storage.Create(FileDesc{Type: TypePage, Num: idx})
 	if err != nil {
-		return err
+		return newError("DiskPool.WriteFrame", ErrIO, idx, err)
+	}
+	defer func() { _ = w.Close() }()
+	if _, err := w.Write(pf.frame); err != nil {
+		return newError("DiskPool.WriteFrame", ErrIO, idx, err)
 	}
 	return nil
 }
@@ -288,16 +303,20 @@ func (pf *PageFrame) WithWrite(f func(*[]byte) error) error {
 
 type Evictor interface {
 	// Evict selects a victim BufferPoolId candidate and returns it.
-	// Evict does not delete from the lru; Evict is stateless.
-	Evict(pages []*PageFrame, pageFrameIndex map[FramePoolId]BufferPoolId, lru *UniqueStack[BufferPoolId]) (FramePoolId, error)
+	// Evict does not delete from the lru; Evict is stateless. txPinned
+	// holds the BufferPoolIds a read transaction has snapshotted and
+	// which must therefore not be chosen; a page any Tx (read or write)
+	// has pinned via AcquirePage, reflected in pages[idx].Pins(), must
+	// likewise not be chosen.
+	Evict(pages []*PageFrame, pageFrameIndex map[FramePoolId]BufferPoolId, lru *UniqueStack[BufferPoolId], txPinned map[BufferPoolId]bool) (FramePoolId, error)
 }
 
 type RandomEvictor struct{}
 
-func (o RandomEvictor) Evict(pages []*PageFrame, _ map[FramePoolId]BufferPoolId, _ *UniqueStack[BufferPoolId]) (FramePoolId, error) {
+func (o RandomEvictor) Evict(pages []*PageFrame, _ map[FramePoolId]BufferPoolId, _ *UniqueStack[BufferPoolId], txPinned map[BufferPoolId]bool) (FramePoolId, error) {
 	potential := rand.Int() % (len(pages) - 1)
 	for true {
-		if pages[potential].Pins() > 0 {
+		if pages[potential].Pins() > 0 || txPinned[potential] {
 			potential = rand.Int() % (len(pages) - 1)
 		} else {
 			break
@@ -308,14 +327,29 @@ func (o RandomEvictor) Evict(pages []*PageFrame, _ map[FramePoolId]BufferPoolId,
 
 type BottomEvictor struct{}
 
-func (o BottomEvictor) Evict(_ []*PageFrame, frame2Buf map[FramePoolId]BufferPoolId, lru *UniqueStack[BufferPoolId]) (FramePoolId, error) {
-	pageId := lru.Bottom()
-	for k, v := range frame2Buf {
-		if v == pageId {
+func (o BottomEvictor) Evict(pages []*PageFrame, frame2Buf map[FramePoolId]BufferPoolId, lru *UniqueStack[BufferPoolId], txPinned map[BufferPoolId]bool) (FramePoolId, error) {
+	for _, pageId := range lru.OrderedRead() {
+		if txPinned[pageId] {
+			continue
+		}
+		found := false
+		for k, v := range frame2Buf {
+			if v != pageId {
+				continue
+			}
+			found = true
+			if pages[k].Pins() > 0 {
+				// Pinned by an open Tx (read or write); try the next
+				// least-recently-used candidate instead.
+				break
+			}
 			return k, nil
 		}
+		if !found {
+			return -1, newError("BottomEvictor.Evict", ErrIncoherentState, -1, fmt.Errorf("lru pageId %v not found in pages", pageId))
+		}
 	}
-	return -1, fmt.Errorf("state incoherence error in eviction: unable to find selected lru pageId (%v) in pages", pageId)
+	return -1, newError("BottomEvictor.Evict", ErrEvictionFailed, -1, fmt.Errorf("every candidate is pinned"))
 }
 
 // BufferPoolId  indexes into the buffer framePool, which is a small framePool.
@@ -344,6 +378,22 @@ type BufferPool struct {
 	// evictor, a pluggable system.
 	evictor Evictor
 
+	// tableLock guards pages, buf2Frame, frame2Buf, and the eviction
+	// sequence that mutates them together, so concurrent AcquirePage/
+	// ReleasePage/FSync calls - whether made directly or via Tx/Slab -
+	// can't race on the page table or trip Go's concurrent map
+	// read/write detector.
+	tableLock sync.Mutex
+
+	// txLock enforces single-writer/multi-reader across Tx: Begin(true)
+	// takes it exclusively, Begin(false) takes it for reading.
+	txLock sync.RWMutex
+	// txPinned marks BufferPoolIds a read Tx has snapshotted; evictors
+	// must not choose them until the owning Tx ends. Guarded by pinLock
+	// rather than txLock, since many read txs hold txLock.RLock at once.
+	txPinned map[BufferPoolId]bool
+	pinLock  sync.Mutex
+
 	// These two will be set on failures in `defers`
 	failureDetected bool
 	failure         error
@@ -363,111 +413,57 @@ func NewBufferPool(size int, pool FramePool, evictor Evictor) *BufferPool {
 		lru:       NewUniqueStack[int](),
 		framePool: pool,
 		evictor:   evictor,
+		txPinned:  map[BufferPoolId]bool{},
 	}
 }
 
-// A Slab is a pseudocontiguous chunk of memory overlaying a bufferpool
-type Slab struct {
-	// The bufferpool that this slab is a part of
-	pool *BufferPool
-	// Bytes per stride, for each slot in the bufferpool
-	strideWidth int
-	// The size of the slab
-	size int
-}
-
-func NewSlab(frameSize int, backingPath string) (*Slab, error) {
-	fp, err := NewDiskPool(frameSize, backingPath)
-	if err != nil {
-		return nil, err
-	}
-	return &Slab{
-		size:        0,
-		strideWidth: 16,
-		pool:        NewBufferPool(100, fp, BottomEvictor{}),
-	}, nil
-}
-
-// Put - Writes bytes to index in the slab
-func (slab *Slab) Put(startingIndex int, data []byte) error {
-	return fmt.Errorf("unable to put to a slab thank you")
-	/*
-		// find the starting buffer to write to
-		targetBufferStart := startingIndex / slab.strideWidth
-		targetIndexModulus := startingIndex % slab.strideWidth
-		width := len(data)/slab.strideWidth + 1
-
-		// We acquire a page, write from the starting index to the end of the page, then release the page.
-		// We then acquire the next page, write from the start of the page to the end of the data, then release the page.
-		// We repeat this process until we have written all of the data.
-		data_counter := 0
-		for bufferIndex := targetBufferStart; bufferIndex < targetBufferStart+width; bufferIndex++ {
-			if err := func() error {
-				page, err := slab.pool.AcquirePage(bufferIndex)
-				defer func() { _ = slab.pool.ReleasePage(bufferIndex) }()
-
-				if err != nil {
-					return err
-				}
-				page.WithWrite(func(d *[]byte) error {
-					for i := bufferIndex * slab.strideWidth; i < (bufferIndex+1)*slab.strideWidth && data_counter < len(data); i++ {
-						(*d)[i] = data[data_counter]
-						data_counter++
-					}
-					return nil
-				})
-				return nil
-			}(); err != nil {
-				return err
-			}
-		}
-
-		for i := target; i < target+width; i++ {
-			bufferIndex := i % slab.strideWidth
-			page, err := slab.pool.AcquirePage(bufferIndex)
-			if err != nil {
-				return err
-			}
-			page.WithWrite(func(d *[]byte) error {
-				*d = data
-			})
-			defer func() { _ = slab.pool.ReleasePage(target) }()
-		}
-	*/
-}
-
-// Get - Gets bytes from index in the slab.
-func (slab *Slab) Get(idx int) ([]byte, error) {
-	return nil, fmt.Errorf("unable to GET from a slab thank you")
-	/*
-		if idx > bp.framePool.Size() || idx < 0 {
-			return nil, fmt.Errorf("index out of range: %d", idx)
-		}
-		pf, err := bp.AcquirePage(idx)
-		if err != nil {
-			return nil, err
-		}
-		defer func() { _ = bp.ReleasePage(idx) }()
-		return pf.DataClone(), nil
-	*/
-}
-
 // ReleasePage decrements the pin of `idx`.
+//
+// ReleasePage takes the BufferPool's single-writer/multi-reader txLock for
+// reading, so a direct call can't race with an in-flight write Tx. Tx calls
+// releasePageTxLocked instead, since a Tx already holds txLock for its
+// whole lifetime.
 func (bp *BufferPool) ReleasePage(idx FramePoolId) error {
+	bp.txLock.RLock()
+	defer bp.txLock.RUnlock()
+	return bp.releasePageTxLocked(idx)
+}
+
+// releasePageTxLocked is ReleasePage's body; callers must already hold
+// txLock (in either mode).
+func (bp *BufferPool) releasePageTxLocked(idx FramePoolId) error {
+	bp.tableLock.Lock()
+	defer bp.tableLock.Unlock()
 	if idx > bp.size || idx < 0 {
-		return fmt.Errorf("index out of range: %d", idx)
+		return newError("BufferPool.ReleasePage", ErrOutOfRange, int(idx), nil)
 	}
 	pageIdx, ok := bp.frame2Buf[idx]
 	if !ok {
-		return fmt.Errorf("not valid page: %d", idx)
+		return newError("BufferPool.ReleasePage", ErrNotFound, int(idx), nil)
 	}
 	bp.pages[pageIdx].DecPin()
 	return nil
 }
 
-// AcquirePage - page is acquired from its data source, if need be, then the Pin is incremented.
+// AcquirePage - page is acquired from its data source, if need be, then the
+// Pin is incremented.
+//
+// AcquirePage takes the BufferPool's single-writer/multi-reader txLock for
+// reading, so it can't race with an in-flight write Tx mutating the same
+// page table or overlay. Tx calls acquirePageTxLocked instead, since a Tx
+// already holds txLock for its whole lifetime.
 func (bp *BufferPool) AcquirePage(idx FramePoolId) (*PageFrame, error) {
-	p, err := bp.GetPage(idx)
+	bp.txLock.RLock()
+	defer bp.txLock.RUnlock()
+	return bp.acquirePageTxLocked(idx)
+}
+
+// acquirePageTxLocked is AcquirePage's body; callers must already hold
+// txLock (in either mode).
+func (bp *BufferPool) acquirePageTxLocked(idx FramePoolId) (*PageFrame, error) {
+	bp.tableLock.Lock()
+	defer bp.tableLock.Unlock()
+	p, err := bp.getPageLocked(idx)
 	if err != nil {
 		return nil, err
 	}
@@ -475,9 +471,25 @@ func (bp *BufferPool) AcquirePage(idx FramePoolId) (*PageFrame, error) {
 	return p, nil
 }
 
+// GetPage loads idx into the pool (evicting a victim first if full) and
+// returns its PageFrame, without pinning it - prefer AcquirePage, which
+// pins atomically with the load so the page can't be evicted out from
+// under the caller before it gets a chance to pin it itself.
+//
+// Like AcquirePage, GetPage takes txLock for reading so it can't race with
+// an in-flight write Tx.
 func (bp *BufferPool) GetPage(idx FramePoolId) (*PageFrame, error) {
+	bp.txLock.RLock()
+	defer bp.txLock.RUnlock()
+	bp.tableLock.Lock()
+	defer bp.tableLock.Unlock()
+	return bp.getPageLocked(idx)
+}
+
+// getPageLocked is GetPage's body; callers must hold tableLock.
+func (bp *BufferPool) getPageLocked(idx FramePoolId) (*PageFrame, error) {
 	if idx > bp.framePool.Size() - -1 {
-		return nil, fmt.Errorf("bufferpool index out of range %d", idx)
+		return nil, newError("BufferPool.GetPage", ErrOutOfRange, int(idx), nil)
 	}
 
 	_, ok := bp.buf2Frame[idx]
@@ -488,7 +500,7 @@ func (bp *BufferPool) GetPage(idx FramePoolId) (*PageFrame, error) {
 
 			// TYPE ERRORS
 			victimIndex, err := bp.evictor.Evict(bp.pages,
-				bp.frame2Buf, bp.lru)
+				bp.frame2Buf, bp.lru, bp.pinnedSnapshot())
 			if err != nil {
 				return nil, err
 			}
@@ -517,7 +529,7 @@ func (bp *BufferPool) GetPage(idx FramePoolId) (*PageFrame, error) {
 			}
 		}
 		if target_index == nil {
-			return nil, fmt.Errorf("unable to find empty slot, error, error")
+			return nil, newError("BufferPool.GetPage", ErrIncoherentState, int(idx), fmt.Errorf("unable to find empty slot after eviction"))
 		}
 		frame, err := bp.framePool.ReadFrame(idx)
 		if err != nil {
@@ -532,13 +544,20 @@ func (bp *BufferPool) GetPage(idx FramePoolId) (*PageFrame, error) {
 	return bp.pages[bp.frame2Buf[idx]], nil
 }
 
+// WritePage mutates page idx directly, outside of any Tx. It takes the
+// BufferPool's single-writer/multi-reader txLock exclusively for the
+// duration of the write, the same way a write Tx does, so it can't race
+// with (or be silently clobbered by) an in-flight Tx's overlay/commit.
 func (bp *BufferPool) WritePage(idx FramePoolId, data []byte) error {
-	page, err := bp.AcquirePage(idx)
+	bp.txLock.Lock()
+	defer bp.txLock.Unlock()
+
+	page, err := bp.acquirePageTxLocked(idx)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		err := bp.ReleasePage(idx)
+		err := bp.releasePageTxLocked(idx)
 		if err != nil {
 			bp.failureDetected = true
 			bp.failure = err
@@ -557,8 +576,10 @@ func (bp *BufferPool) WritePage(idx FramePoolId, data []byte) error {
 }
 
 func (bp *BufferPool) FSync() error {
-	for _, fpId := range bp.buf2Frame {
-		page := bp.pages[fpId]
+	bp.tableLock.Lock()
+	defer bp.tableLock.Unlock()
+	for fpId, bufID := range bp.frame2Buf {
+		page := bp.pages[bufID]
 		e := FSyncSlot(page, bp, fpId)
 		if e != nil {
 			return e
@@ -578,3 +599,47 @@ func FSyncSlot(page *PageFrame, bp *BufferPool, fpId FramePoolId) error {
 	}
 	return nil
 }
+
+// pageForFrame returns the PageFrame currently loaded for frame idx.
+// Callers that hold a pin on idx (so it can't be evicted out from under
+// them) can use this instead of indexing bp's internals directly, which
+// would otherwise race with a concurrent AcquirePage/ReleasePage on an
+// unrelated idx.
+func (bp *BufferPool) pageForFrame(idx FramePoolId) *PageFrame {
+	bp.tableLock.Lock()
+	defer bp.tableLock.Unlock()
+	return bp.pages[bp.frame2Buf[idx]]
+}
+
+// frameBufID returns the BufferPoolId frame idx is currently loaded
+// into. See pageForFrame for why this goes through tableLock.
+func (bp *BufferPool) frameBufID(idx FramePoolId) BufferPoolId {
+	bp.tableLock.Lock()
+	defer bp.tableLock.Unlock()
+	return bp.frame2Buf[idx]
+}
+
+// pinnedSnapshot copies the set of BufferPoolIds currently held by an
+// active read transaction, so an Evictor can be handed a stable view
+// without taking pinLock itself.
+func (bp *BufferPool) pinnedSnapshot() map[BufferPoolId]bool {
+	bp.pinLock.Lock()
+	defer bp.pinLock.Unlock()
+	out := make(map[BufferPoolId]bool, len(bp.txPinned))
+	for k, v := range bp.txPinned {
+		out[k] = v
+	}
+	return out
+}
+
+// markTxPinned records (or clears) that BufferPoolId bufID is being
+// snapshotted by a read transaction and must not be evicted.
+func (bp *BufferPool) markTxPinned(bufID BufferPoolId, pinned bool) {
+	bp.pinLock.Lock()
+	defer bp.pinLock.Unlock()
+	if pinned {
+		bp.txPinned[bufID] = true
+	} else {
+		delete(bp.txPinned, bufID)
+	}
+}
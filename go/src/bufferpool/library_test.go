@@ -184,6 +184,34 @@ func TestBufferPool_FSync(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+// TestBufferPool_FSyncSparseFrameIds guards against FSync indexing bp.pages
+// by FramePoolId instead of translating through frame2Buf first: a pool
+// smaller than the backing store, where FramePoolIds don't line up with
+// their BufferPoolId slots, used to either panic or flush the wrong page.
+func TestBufferPool_FSyncSparseFrameIds(t *testing.T) {
+	td := os.TempDir()
+	t.Logf("temp dir %s", td)
+	mp, err := NewDiskPool(40, td)
+	assert.Nil(t, err)
+
+	bp := NewBufferPool(3, mp, RandomEvictor{})
+	assert.NotNil(t, bp)
+
+	frameIds := []int{10, 20, 30}
+	for _, id := range frameIds {
+		assert.Nil(t, bp.WritePage(id, []byte(fmt.Sprintf("X-%d", id))))
+	}
+
+	assert.Nil(t, bp.FSync())
+	for _, id := range frameIds {
+		b, err := ioutil.ReadFile(fmt.Sprintf("%s/page_%d", td, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, fmt.Sprintf("X-%d", id), string(b))
+	}
+}
+
 // this is a test for the Evict method of the BottomEvictor, which should always take the bottom of the UniqueStack[BufferPoolId]
 func TestBottomEvictor_Evict(t *testing.T) {
 	// create a new BottomEvictor
@@ -196,12 +224,16 @@ func TestBottomEvictor_Evict(t *testing.T) {
 		us.Push(BufferPoolId(i))
 		pfi[100+i] = i
 	}
-	// create empty page frame list
-	pfl := make([]*PageFrame, 0)
+	// page frame list, large enough to index by the FramePoolIds above;
+	// none of them are pinned, so Pins() never excludes a candidate here.
+	pfl := make([]*PageFrame, 1004)
+	for _, idx := range []int{100, 101, 102, 1003} {
+		pfl[idx] = NewPageFrame([]byte{})
+	}
 
 	// call the Evict method on the BottomEvictor
 	// Note that Evict returns a victim, it does not remove the victim
-	victim, err := b.Evict(pfl, pfi, us)
+	victim, err := b.Evict(pfl, pfi, us, map[BufferPoolId]bool{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -225,7 +257,7 @@ func TestBottomEvictor_Evict(t *testing.T) {
 	assert.Equal(t, BufferPoolId(2), us.Bottom())
 	t.Logf("us: %v", us.OrderedRead())
 	t.Logf("pfi: %v", pfi)
-	victim, err = b.Evict(pfl, pfi, us)
+	victim, err = b.Evict(pfl, pfi, us, map[BufferPoolId]bool{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -234,9 +266,18 @@ func TestBottomEvictor_Evict(t *testing.T) {
 
 func TestEndGeneralUsageBufferPool(t *testing.T) {
 	d := t.TempDir()
-	bp, err := NewSlab(4, d)
+	slab, err := NewSlab(4, d)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	h, err := slab.Alloc(10)
+	assert.Nil(t, err)
+	assert.Nil(t, slab.Write(h, []byte("end-to-end")))
+
+	b, err := slab.Read(h)
+	assert.Nil(t, err)
+	assert.Equal(t, "end-to-end", string(b))
+
+	assert.Nil(t, slab.Free(h))
 }
@@ -0,0 +1,103 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package bufferpool
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// MmapPool on this platform falls back to plain positioned file I/O,
+// since the syscall.Mmap the Linux/macOS implementation is built around
+// isn't available here. ReadFrame returns a copy rather than an aliased
+// region, so callers get a working FramePool, just not the zero-copy
+// behavior described for the mmap-backed build.
+type MmapPool struct {
+	file     *os.File
+	pageSize int
+	numPages int
+	m        sync.RWMutex
+}
+
+// NewMmapPool opens (creating if necessary) the backing file at path. A
+// pageSize of 0 or less selects os.Getpagesize().
+func NewMmapPool(path string, pageSize int) (*MmapPool, error) {
+	if pageSize <= 0 {
+		pageSize = os.Getpagesize()
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &MmapPool{
+		file:     f,
+		pageSize: pageSize,
+		numPages: int(info.Size() / int64(pageSize)),
+	}, nil
+}
+
+func (o *MmapPool) AssessSize() (int, error) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return o.numPages, nil
+}
+
+func (o *MmapPool) Size() int {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return o.numPages
+}
+
+func (o *MmapPool) ReadFrame(idx int) (*PageFrame, error) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	if idx < 0 || idx >= o.numPages {
+		return nil, fmt.Errorf("page %d not mapped", idx)
+	}
+	b := make([]byte, o.pageSize)
+	if _, err := o.file.ReadAt(b, int64(idx)*int64(o.pageSize)); err != nil {
+		return nil, err
+	}
+	return NewPageFrame(b), nil
+}
+
+func (o *MmapPool) WriteFrame(idx int, pf *PageFrame) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if idx < 0 || idx >= o.numPages {
+		return fmt.Errorf("page %d not mapped", idx)
+	}
+	var err error
+	pf.WithRead(func(b []byte) {
+		n := len(b)
+		if n > o.pageSize {
+			n = o.pageSize
+		}
+		_, err = o.file.WriteAt(b[:n], int64(idx)*int64(o.pageSize))
+	})
+	return err
+}
+
+func (o *MmapPool) Falloc(n int) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	newSize := int64(o.numPages+n) * int64(o.pageSize)
+	if err := o.file.Truncate(newSize); err != nil {
+		return err
+	}
+	o.numPages += n
+	return nil
+}
+
+// Close closes the backing file. There is no mapping to unmap on this
+// platform.
+func (o *MmapPool) Close() error {
+	return o.file.Close()
+}
@@ -0,0 +1,69 @@
+package bufferpool
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMmapPool_FallocAndReadWrite(t *testing.T) {
+	td := t.TempDir()
+	mp, err := NewMmapPool(filepath.Join(td, "pages.mmap"), 64)
+	assert.Nil(t, err)
+	defer mp.Close()
+
+	assert.Nil(t, mp.Falloc(2))
+	assert.Equal(t, 2, mp.Size())
+
+	assert.Nil(t, mp.WriteFrame(0, NewPageFrame([]byte("hello"))))
+	f, err := mp.ReadFrame(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(f.DataClone()[:5]))
+}
+
+func TestMmapPool_GrowthPreservesEarlierSegment(t *testing.T) {
+	td := t.TempDir()
+	mp, err := NewMmapPool(filepath.Join(td, "pages.mmap"), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close()
+
+	if err := mp.Falloc(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.WriteFrame(0, NewPageFrame([]byte("first"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mp.Falloc(1); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, mp.Size())
+
+	f0, err := mp.ReadFrame(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "first", string(f0.DataClone()[:5]))
+
+	if err := mp.WriteFrame(1, NewPageFrame([]byte("second"))); err != nil {
+		t.Fatal(err)
+	}
+	f1, err := mp.ReadFrame(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "second", string(f1.DataClone()[:6]))
+}
+
+func TestMmapPool_ReadUnmappedPageErrors(t *testing.T) {
+	td := t.TempDir()
+	mp, err := NewMmapPool(filepath.Join(td, "pages.mmap"), 64)
+	assert.Nil(t, err)
+	defer mp.Close()
+
+	_, err = mp.ReadFrame(0)
+	assert.Error(t, err)
+}
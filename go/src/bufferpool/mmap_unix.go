@@ -0,0 +1,182 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package bufferpool
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// mmapSegment is one contiguous mapped region of the backing file,
+// covering pages [startPage, startPage+numPages).
+//
+// mmap's offset argument must be a multiple of the OS page size
+// (os.Getpagesize()), which need not have anything to do with the
+// pool's own, independently configurable pageSize. So raw is the exact
+// slice syscall.Mmap returned - rounded down to the OS page boundary at
+// or before startPage's logical offset, and the only thing Munmap may
+// be called with - while data is raw sliced forward by that rounding
+// delta, giving callers a view that starts exactly at startPage.
+type mmapSegment struct {
+	raw       []byte
+	data      []byte
+	startPage int
+	numPages  int
+}
+
+// MmapPool memory-maps a single backing file, segmented into fixed-size
+// pages, so that ReadFrame returns a PageFrame whose bytes alias the
+// mapped region directly and WriteFrame is a memcpy into it rather than
+// a file write. Falloc maps newly-grown pages as an additional segment
+// instead of remapping the whole file, so PageFrames returned by earlier
+// ReadFrame calls stay valid across growth.
+type MmapPool struct {
+	file     *os.File
+	pageSize int
+	numPages int
+	segments []mmapSegment
+	m        sync.RWMutex
+}
+
+// NewMmapPool opens (creating if necessary) the backing file at path and
+// maps whatever whole pages it already contains. A pageSize of 0 or less
+// selects os.Getpagesize().
+func NewMmapPool(path string, pageSize int) (*MmapPool, error) {
+	if pageSize <= 0 {
+		pageSize = os.Getpagesize()
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	mp := &MmapPool{
+		file:     f,
+		pageSize: pageSize,
+	}
+
+	existingPages := int(info.Size() / int64(pageSize))
+	if existingPages > 0 {
+		if err := mp.mapSegment(0, existingPages); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		mp.numPages = existingPages
+	}
+	return mp, nil
+}
+
+func (o *MmapPool) mapSegment(startPage, numPages int) error {
+	osPageSize := int64(os.Getpagesize())
+	logicalOffset := int64(startPage) * int64(o.pageSize)
+	mmapOffset := logicalOffset - logicalOffset%osPageSize
+	delta := int(logicalOffset - mmapOffset)
+	length := delta + numPages*o.pageSize
+	raw, err := syscall.Mmap(int(o.file.Fd()), mmapOffset, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("mmap segment at page %d (%d pages): %w", startPage, numPages, err)
+	}
+	o.segments = append(o.segments, mmapSegment{raw: raw, data: raw[delta:], startPage: startPage, numPages: numPages})
+	return nil
+}
+
+func (o *MmapPool) segmentFor(idx int) (*mmapSegment, error) {
+	for i := range o.segments {
+		seg := &o.segments[i]
+		if idx >= seg.startPage && idx < seg.startPage+seg.numPages {
+			return seg, nil
+		}
+	}
+	return nil, fmt.Errorf("page %d not mapped", idx)
+}
+
+func (o *MmapPool) AssessSize() (int, error) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return o.numPages, nil
+}
+
+func (o *MmapPool) Size() int {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return o.numPages
+}
+
+// ReadFrame returns a PageFrame whose bytes alias the mapped file
+// directly; writing through the returned PageFrame without going back
+// through WriteFrame will still land in the mapping (and, eventually,
+// the file) but bypasses the msync WriteFrame performs.
+func (o *MmapPool) ReadFrame(idx int) (*PageFrame, error) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	seg, err := o.segmentFor(idx)
+	if err != nil {
+		return nil, err
+	}
+	offset := (idx - seg.startPage) * o.pageSize
+	return NewPageFrame(seg.data[offset : offset+o.pageSize]), nil
+}
+
+func (o *MmapPool) WriteFrame(idx int, pf *PageFrame) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	seg, err := o.segmentFor(idx)
+	if err != nil {
+		return err
+	}
+	offset := (idx - seg.startPage) * o.pageSize
+	pf.WithRead(func(b []byte) {
+		copy(seg.data[offset:offset+o.pageSize], b)
+	})
+	return o.msync()
+}
+
+// Falloc grows the backing file by n pages and maps the new region as an
+// additional segment; existing segments, and any PageFrames aliasing
+// them, are left untouched.
+func (o *MmapPool) Falloc(n int) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	newSize := int64(o.numPages+n) * int64(o.pageSize)
+	if err := o.file.Truncate(newSize); err != nil {
+		return err
+	}
+	if err := o.mapSegment(o.numPages, n); err != nil {
+		return err
+	}
+	o.numPages += n
+	return nil
+}
+
+// msync flushes dirty mapped pages to the backing file. A MAP_SHARED
+// mapping and the file descriptor it came from share the same page
+// cache entries, so fsync-ing the file is sufficient and keeps this
+// portable across the platforms this file is built for.
+func (o *MmapPool) msync() error {
+	return o.file.Sync()
+}
+
+// Close unmaps every segment and closes the backing file.
+func (o *MmapPool) Close() error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	var firstErr error
+	for _, seg := range o.segments {
+		if err := syscall.Munmap(seg.raw); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	o.segments = nil
+	if err := o.file.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
@@ -0,0 +1,547 @@
+package bufferpool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// AllocAlign is the byte alignment every Handle offset is guaranteed to
+// satisfy; it falls out naturally from slotSizes and pageHeaderSize both
+// being multiples of it.
+const AllocAlign = 16
+
+// maxSlot is the largest size class a small (in-page) allocation can
+// satisfy. Requests that don't fit - after the per-slot bookkeeping
+// overhead below - get a dedicated run of whole pages instead.
+const maxSlot = 1024
+
+// slotSizes are the size classes small allocations are rounded up into,
+// each with its own intrusive freelist per page. It's a fixed-size array
+// rather than a slice so slotRanks can stay a compile-time constant.
+var slotSizes = [...]int{16, 32, 64, 128, 256, 512, maxSlot}
+
+const slotRanks = len(slotSizes)
+
+// Each page's header is a brk (the byte offset of the next never-used
+// byte, for bump allocation) followed by one freelist head per rank.
+const (
+	pageBrkOffset       = 0
+	pageFreeHeadsOffset = 4
+	pageHeaderSize      = pageFreeHeadsOffset + slotRanks*4
+)
+
+// Every small allocation reserves a few bytes ahead of the bytes handed
+// back to the caller:
+//   - rankTagOffset: which slotSizes rank this slot belongs to. Written
+//     once when the slot is first carved out of a page's bump region and
+//     never touched again, so Free/Read/Write can recover the rank from
+//     a bare Handle.
+//   - lengthOffset: how many of the slot's payload bytes are in use.
+//     Only meaningful while the slot is allocated; while free, these
+//     same bytes are the first two bytes of the freelist next-pointer.
+//   - freeNextOffset: the offset of the next free slot of this rank, or
+//     -1. Only meaningful while the slot is free.
+const (
+	rankTagOffset  = 0
+	lengthOffset   = 1
+	freeNextOffset = 1
+	payloadOffset  = 3
+)
+
+const noFreeSlot = int32(-1)
+
+// Handle identifies a Slab allocation: which page it lives on, and
+// where within the page (or, for a large allocation, within the run of
+// pages starting there) it begins.
+type Handle int64
+
+func newHandle(pageID, offset int) Handle {
+	return Handle(int64(pageID)<<32 | int64(uint32(offset)))
+}
+
+func (h Handle) pageID() int {
+	return int(int64(h) >> 32)
+}
+
+func (h Handle) offset() int {
+	return int(int32(uint32(int64(h))))
+}
+
+func readPageBrk(b []byte) int32 {
+	return int32(binary.BigEndian.Uint32(b[pageBrkOffset : pageBrkOffset+4]))
+}
+
+func writePageBrk(b []byte, v int32) {
+	binary.BigEndian.PutUint32(b[pageBrkOffset:pageBrkOffset+4], uint32(v))
+}
+
+func freeHeadOffset(rank int) int {
+	return pageFreeHeadsOffset + rank*4
+}
+
+func readFreeSlotHead(b []byte, rank int) int32 {
+	off := freeHeadOffset(rank)
+	return int32(binary.BigEndian.Uint32(b[off : off+4]))
+}
+
+func writeFreeSlotHead(b []byte, rank int, v int32) {
+	off := freeHeadOffset(rank)
+	binary.BigEndian.PutUint32(b[off:off+4], uint32(v))
+}
+
+// initSlabPage resets a page to a fresh, empty small-object page: brk
+// just past the header, every rank's freelist empty.
+func initSlabPage(b []byte) {
+	writePageBrk(b, int32(pageHeaderSize))
+	for rank := 0; rank < slotRanks; rank++ {
+		writeFreeSlotHead(b, rank, noFreeSlot)
+	}
+}
+
+// rankForSize returns the smallest size class whose usable payload (the
+// slot size, less the bookkeeping bytes above) fits size, or false if
+// size needs a large allocation instead.
+func rankForSize(size int) (int, bool) {
+	for rank, slotSize := range slotSizes {
+		if size <= slotSize-payloadOffset {
+			return rank, true
+		}
+	}
+	return 0, false
+}
+
+func pageFullyEmpty(b []byte) bool {
+	used := int(readPageBrk(b)) - pageHeaderSize
+	if used <= 0 {
+		return true
+	}
+	free := 0
+	for rank, slotSize := range slotSizes {
+		for node := readFreeSlotHead(b, rank); node != noFreeSlot; {
+			free += slotSize
+			node = int32(binary.BigEndian.Uint32(b[int(node)+freeNextOffset : int(node)+freeNextOffset+4]))
+		}
+	}
+	return free == used
+}
+
+// Slab is a pseudocontiguous heap of variable-sized allocations
+// overlaying a BufferPool: small requests are carved out of size-classed
+// slots with a per-page intrusive freelist, and large requests get their
+// own dedicated run of whole pages.
+type Slab struct {
+	pool      *BufferPool
+	framePool FramePool
+	pageSize  int
+
+	m sync.Mutex
+	// pageCount is the number of pages ever handed to framePool.Falloc;
+	// large allocations rely on it being monotonic to get contiguous
+	// page runs without having to search for them.
+	pageCount int
+	// smallPages are pages that have been initialized for small-object
+	// allocation; Alloc scans them for room before falling back to a
+	// fresh page.
+	smallPages []int
+	// freePages are fully-empty pages available for reuse as a future
+	// small-object page. Large allocations don't draw from this list -
+	// they need pages to already be contiguous - so a freed large run's
+	// pages can only come back as small-object pages.
+	freePages []int
+	// largeRuns maps a large allocation's starting pageID to how many
+	// pages it spans.
+	largeRuns map[int]int
+}
+
+// NewSlab creates a Slab backed by a DiskPool of at least frameSize
+// pages rooted at backingPath.
+func NewSlab(frameSize int, backingPath string) (*Slab, error) {
+	fp, err := NewDiskPool(frameSize, backingPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Slab{
+		pageSize:  4096,
+		framePool: fp,
+		pool:      NewBufferPool(100, fp, BottomEvictor{}),
+		largeRuns: map[int]int{},
+	}, nil
+}
+
+// Alloc reserves size bytes and returns a Handle for Read/Write/Free to
+// address them by.
+func (slab *Slab) Alloc(size int) (Handle, error) {
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid alloc size: %d", size)
+	}
+	if _, ok := rankForSize(size); !ok {
+		return slab.allocLarge(size)
+	}
+	return slab.allocSmall(size)
+}
+
+func (slab *Slab) allocSmall(size int) (Handle, error) {
+	rank, ok := rankForSize(size)
+	if !ok {
+		return 0, fmt.Errorf("no size class fits %d bytes", size)
+	}
+	slotSize := slotSizes[rank]
+
+	slab.m.Lock()
+	pages := append([]int(nil), slab.smallPages...)
+	slab.m.Unlock()
+
+	for _, pageID := range pages {
+		h, ok, err := slab.tryAllocInPage(pageID, rank, slotSize)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return h, nil
+		}
+	}
+
+	pageID, err := slab.allocPage()
+	if err != nil {
+		return 0, err
+	}
+	slab.m.Lock()
+	slab.smallPages = append(slab.smallPages, pageID)
+	slab.m.Unlock()
+
+	h, ok, err := slab.tryAllocInPage(pageID, rank, slotSize)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("freshly allocated page %d has no room for a %d byte slot", pageID, slotSize)
+	}
+	return h, nil
+}
+
+// tryAllocInPage carves a slotSize slot of the given rank out of pageID,
+// preferring a slot already on the rank's freelist and otherwise bumping
+// brk. It reports false (with no error) if the page simply has no room.
+func (slab *Slab) tryAllocInPage(pageID, rank, slotSize int) (Handle, bool, error) {
+	page, err := slab.pool.AcquirePage(pageID)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = slab.pool.ReleasePage(pageID) }()
+
+	var handle Handle
+	found := false
+	err = page.WithWrite(func(b *[]byte) error {
+		buf := *b
+		if head := readFreeSlotHead(buf, rank); head != noFreeSlot {
+			next := int32(binary.BigEndian.Uint32(buf[int(head)+freeNextOffset : int(head)+freeNextOffset+4]))
+			writeFreeSlotHead(buf, rank, next)
+			binary.BigEndian.PutUint16(buf[int(head)+lengthOffset:int(head)+lengthOffset+2], 0)
+			handle = newHandle(pageID, int(head))
+			found = true
+			return nil
+		}
+		brk := readPageBrk(buf)
+		if int(brk)+slotSize > len(buf) {
+			return nil
+		}
+		buf[int(brk)+rankTagOffset] = byte(rank)
+		binary.BigEndian.PutUint16(buf[int(brk)+lengthOffset:int(brk)+lengthOffset+2], 0)
+		writePageBrk(buf, brk+int32(slotSize))
+		handle = newHandle(pageID, int(brk))
+		found = true
+		return nil
+	})
+	return handle, found, err
+}
+
+// allocPage returns a page initialized for small-object allocation,
+// reusing a fully-empty page if one is available.
+func (slab *Slab) allocPage() (int, error) {
+	slab.m.Lock()
+	if n := len(slab.freePages); n > 0 {
+		pageID := slab.freePages[n-1]
+		slab.freePages = slab.freePages[:n-1]
+		slab.m.Unlock()
+		return pageID, slab.initSmallPage(pageID)
+	}
+	// Falloc stays under slab.m, rather than being called after
+	// unlocking, so pageCount's bump and the backing store's own append
+	// can't interleave with another goroutine's: two concurrent callers
+	// would otherwise risk the second one's Falloc call landing before
+	// the first's, handing out a pageID that doesn't match the page
+	// framePool actually just created for it.
+	pageID := slab.pageCount
+	slab.pageCount++
+	defer slab.m.Unlock()
+
+	if err := slab.framePool.Falloc(1); err != nil {
+		return 0, err
+	}
+	return pageID, slab.initSmallPage(pageID)
+}
+
+func (slab *Slab) initSmallPage(pageID int) error {
+	page, err := slab.pool.AcquirePage(pageID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = slab.pool.ReleasePage(pageID) }()
+	return page.WithWrite(func(b *[]byte) error {
+		*b = make([]byte, slab.pageSize)
+		initSlabPage(*b)
+		return nil
+	})
+}
+
+// allocLarge reserves a contiguous run of whole pages for an allocation
+// too big for any size class. The run's first 8 bytes are a uint64
+// length prefix; the rest of the run is raw payload.
+func (slab *Slab) allocLarge(size int) (Handle, error) {
+	numPages := (size + 8 + slab.pageSize - 1) / slab.pageSize
+
+	// Falloc stays under slab.m for the same reason as in allocPage: it
+	// must not interleave with another goroutine's pageCount bump and
+	// Falloc call, or the pages hereafter addressed as startPageID..
+	// startPageID+numPages may not be the ones framePool actually just
+	// created.
+	slab.m.Lock()
+	startPageID := slab.pageCount
+	slab.pageCount += numPages
+	slab.largeRuns[startPageID] = numPages
+	err := slab.framePool.Falloc(numPages)
+	slab.m.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	for p := startPageID; p < startPageID+numPages; p++ {
+		page, err := slab.pool.AcquirePage(p)
+		if err != nil {
+			return 0, err
+		}
+		err = page.WithWrite(func(b *[]byte) error {
+			*b = make([]byte, slab.pageSize)
+			return nil
+		})
+		_ = slab.pool.ReleasePage(p)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return newHandle(startPageID, 0), nil
+}
+
+// Free releases the allocation h refers to. A small allocation's slot is
+// pushed back onto its rank's freelist; if that leaves the whole page
+// empty, the page is reset and returned to the page freelist. A large
+// allocation's pages are returned to the page freelist directly.
+func (slab *Slab) Free(h Handle) error {
+	pageID := h.pageID()
+
+	slab.m.Lock()
+	numPages, isLarge := slab.largeRuns[pageID]
+	if isLarge {
+		delete(slab.largeRuns, pageID)
+	}
+	slab.m.Unlock()
+
+	if isLarge {
+		slab.m.Lock()
+		for p := pageID; p < pageID+numPages; p++ {
+			slab.freePages = append(slab.freePages, p)
+		}
+		slab.m.Unlock()
+		return nil
+	}
+
+	offset := h.offset()
+	page, err := slab.pool.AcquirePage(pageID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = slab.pool.ReleasePage(pageID) }()
+
+	nowEmpty := false
+	err = page.WithWrite(func(b *[]byte) error {
+		buf := *b
+		rank := int(buf[offset+rankTagOffset])
+		if rank < 0 || rank >= slotRanks {
+			return fmt.Errorf("corrupt slot at page %d offset %d: bad rank tag %d", pageID, offset, rank)
+		}
+		head := readFreeSlotHead(buf, rank)
+		binary.BigEndian.PutUint32(buf[offset+freeNextOffset:offset+freeNextOffset+4], uint32(head))
+		writeFreeSlotHead(buf, rank, int32(offset))
+		if pageFullyEmpty(buf) {
+			// Reset right here, inside the same WithWrite call that just
+			// freed the slot, rather than in a later call of our own:
+			// once this closure returns, the page's write lock is free
+			// for a concurrent tryAllocInPage to carve a fresh slot into
+			// it, and a reset made afterward would wipe that slot right
+			// back out from under its caller.
+			*b = make([]byte, slab.pageSize)
+			initSlabPage(*b)
+			nowEmpty = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if nowEmpty {
+		slab.m.Lock()
+		slab.removeSmallPageLocked(pageID)
+		slab.freePages = append(slab.freePages, pageID)
+		slab.m.Unlock()
+	}
+	return nil
+}
+
+// removeSmallPageLocked drops pageID from smallPages, if present. Callers
+// must hold slab.m. It's used when a page is reclaimed onto freePages, so
+// a page can never be live on both lists at once - otherwise allocSmall's
+// scan could hand the page out while it's still sitting on freePages,
+// and a later allocPage could then pop it off freePages and re-init it,
+// wiping out whatever the scan path had just allocated there.
+func (slab *Slab) removeSmallPageLocked(pageID int) {
+	for i, id := range slab.smallPages {
+		if id == pageID {
+			slab.smallPages = append(slab.smallPages[:i], slab.smallPages[i+1:]...)
+			return
+		}
+	}
+}
+
+// Read returns a copy of the bytes last Write'n (or Alloc's zero bytes,
+// if nothing has been written yet) at h.
+func (slab *Slab) Read(h Handle) ([]byte, error) {
+	pageID := h.pageID()
+
+	slab.m.Lock()
+	numPages, isLarge := slab.largeRuns[pageID]
+	slab.m.Unlock()
+	if isLarge {
+		return slab.readLarge(pageID, numPages)
+	}
+
+	offset := h.offset()
+	page, err := slab.pool.AcquirePage(pageID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = slab.pool.ReleasePage(pageID) }()
+
+	var out []byte
+	var rerr error
+	page.WithRead(func(b []byte) {
+		rank := int(b[offset+rankTagOffset])
+		if rank < 0 || rank >= slotRanks {
+			rerr = fmt.Errorf("corrupt slot at page %d offset %d: bad rank tag %d", pageID, offset, rank)
+			return
+		}
+		length := int(binary.BigEndian.Uint16(b[offset+lengthOffset : offset+lengthOffset+2]))
+		out = append([]byte(nil), b[offset+payloadOffset:offset+payloadOffset+length]...)
+	})
+	return out, rerr
+}
+
+// Write overwrites the bytes at h with data, which must fit within the
+// size class (or, for a large allocation, the page run) Alloc reserved.
+func (slab *Slab) Write(h Handle, data []byte) error {
+	pageID := h.pageID()
+
+	slab.m.Lock()
+	numPages, isLarge := slab.largeRuns[pageID]
+	slab.m.Unlock()
+	if isLarge {
+		return slab.writeLarge(pageID, numPages, data)
+	}
+
+	offset := h.offset()
+	page, err := slab.pool.AcquirePage(pageID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = slab.pool.ReleasePage(pageID) }()
+
+	return page.WithWrite(func(b *[]byte) error {
+		buf := *b
+		rank := int(buf[offset+rankTagOffset])
+		if rank < 0 || rank >= slotRanks {
+			return fmt.Errorf("corrupt slot at page %d offset %d: bad rank tag %d", pageID, offset, rank)
+		}
+		capacity := slotSizes[rank] - payloadOffset
+		if len(data) > capacity {
+			return fmt.Errorf("write of %d bytes exceeds %d byte capacity of slot at page %d offset %d", len(data), capacity, pageID, offset)
+		}
+		binary.BigEndian.PutUint16(buf[offset+lengthOffset:offset+lengthOffset+2], uint16(len(data)))
+		copy(buf[offset+payloadOffset:offset+payloadOffset+len(data)], data)
+		return nil
+	})
+}
+
+func (slab *Slab) readLarge(startPageID, numPages int) ([]byte, error) {
+	var length uint64
+	var out []byte
+	for p := 0; p < numPages; p++ {
+		page, err := slab.pool.AcquirePage(startPageID + p)
+		if err != nil {
+			return nil, err
+		}
+		page.WithRead(func(b []byte) {
+			start := 0
+			if p == 0 {
+				length = binary.BigEndian.Uint64(b[0:8])
+				start = 8
+			}
+			need := int(length) - len(out)
+			if need <= 0 {
+				return
+			}
+			avail := b[start:]
+			if need < len(avail) {
+				avail = avail[:need]
+			}
+			out = append(out, avail...)
+		})
+		_ = slab.pool.ReleasePage(startPageID + p)
+		if len(out) >= int(length) {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (slab *Slab) writeLarge(startPageID, numPages int, data []byte) error {
+	capacity := numPages*slab.pageSize - 8
+	if len(data) > capacity {
+		return fmt.Errorf("write of %d bytes exceeds %d byte capacity of the run at page %d", len(data), capacity, startPageID)
+	}
+	remaining := data
+	for p := 0; p < numPages; p++ {
+		page, err := slab.pool.AcquirePage(startPageID + p)
+		if err != nil {
+			return err
+		}
+		err = page.WithWrite(func(b *[]byte) error {
+			buf := *b
+			start := 0
+			if p == 0 {
+				binary.BigEndian.PutUint64(buf[0:8], uint64(len(data)))
+				start = 8
+			}
+			n := copy(buf[start:], remaining)
+			remaining = remaining[n:]
+			return nil
+		})
+		_ = slab.pool.ReleasePage(startPageID + p)
+		if err != nil {
+			return err
+		}
+		if len(remaining) == 0 {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package bufferpool
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlab_AllocWriteReadRoundTrip(t *testing.T) {
+	s, err := NewSlab(4, t.TempDir())
+	assert.Nil(t, err)
+
+	h, err := s.Alloc(10)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Write(h, []byte("0123456789")))
+	b, err := s.Read(h)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(b))
+}
+
+func TestSlab_FreeThenAllocReusesSlot(t *testing.T) {
+	s, err := NewSlab(4, t.TempDir())
+	assert.Nil(t, err)
+
+	h1, err := s.Alloc(10)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Write(h1, []byte("first")))
+	assert.Nil(t, s.Free(h1))
+
+	h2, err := s.Alloc(10)
+	assert.Nil(t, err)
+	assert.Equal(t, h1, h2, "freeing the only allocation in a rank and re-allocating the same size should reuse its slot")
+
+	b, err := s.Read(h2)
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(b), "a reused slot should not see the prior occupant's data as its length")
+}
+
+func TestSlab_WriteRejectsOversizedPayload(t *testing.T) {
+	s, err := NewSlab(4, t.TempDir())
+	assert.Nil(t, err)
+
+	h, err := s.Alloc(10)
+	assert.Nil(t, err)
+	assert.Error(t, s.Write(h, bytes.Repeat([]byte("x"), 1000)))
+}
+
+// TestSlab_ConcurrentAllocWrite exercises Alloc/Write/Read from many
+// goroutines at once. It's backed by a MockPool rather than NewSlab's
+// usual DiskPool so it isolates BufferPool's own page-table locking
+// from DiskPool's separate bookkeeping. Run with -race to confirm.
+func TestSlab_ConcurrentAllocWrite(t *testing.T) {
+	fp := NewMockPool(64)
+	s := &Slab{
+		pageSize:  4096,
+		framePool: fp,
+		pool:      NewBufferPool(20, fp, BottomEvictor{}),
+		largeRuns: map[int]int{},
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			data := []byte(fmt.Sprintf("goroutine-%02d", g))
+			h, err := s.Alloc(len(data))
+			if err != nil {
+				t.Errorf("Alloc: %v", err)
+				return
+			}
+			if err := s.Write(h, data); err != nil {
+				t.Errorf("Write: %v", err)
+				return
+			}
+			got, err := s.Read(h)
+			if err != nil {
+				t.Errorf("Read: %v", err)
+				return
+			}
+			if string(got) != string(data) {
+				t.Errorf("roundtrip mismatch: want %q got %q", data, got)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestSlab_LargeAllocationSpansPages(t *testing.T) {
+	s, err := NewSlab(4, t.TempDir())
+	assert.Nil(t, err)
+
+	big := bytes.Repeat([]byte("y"), 9000)
+	h, err := s.Alloc(len(big))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Write(h, big))
+	b, err := s.Read(h)
+	assert.Nil(t, err)
+	assert.Equal(t, big, b)
+
+	assert.Nil(t, s.Free(h))
+}
+
+// TestSlab_FreeThenScanReuseSurvivesPageExhaustion guards against a page
+// living on both smallPages and freePages at once. A small pageSize (6
+// rank-0 slots per page) makes the sequence easy to drive by hand: fill
+// page 0, spill one slot into page 1, free it so page 1 is reclaimed onto
+// freePages, then allocate again so page 1 is handed out a second time. If
+// Free didn't also drop the page from smallPages (removeSmallPageLocked),
+// allocSmall's scan would reuse page 1 while it was still on freePages,
+// and a later allocPage() call - once exhausting both pages forces one -
+// would pop page 1 off freePages again and re-initialize it, silently
+// wiping the data just written there.
+func TestSlab_FreeThenScanReuseSurvivesPageExhaustion(t *testing.T) {
+	fp := NewMockPool(64)
+	s := &Slab{
+		pageSize:  128,
+		framePool: fp,
+		pool:      NewBufferPool(20, fp, BottomEvictor{}),
+		largeRuns: map[int]int{},
+	}
+	const slotsPerPage = 6 // (128 byte page - 32 byte header) / 16 byte rank-0 slot
+
+	// Fill page 0 completely.
+	for i := 0; i < slotsPerPage; i++ {
+		_, err := s.Alloc(10)
+		assert.Nil(t, err)
+	}
+
+	// Spill one slot into a fresh page 1, then free it - the only
+	// allocation on the page - so it's reclaimed onto freePages.
+	spill, err := s.Alloc(10)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Free(spill))
+
+	// Page 0 is full and page 1 is no longer on smallPages, so this comes
+	// from allocPage() popping page 1 back off freePages.
+	h, err := s.Alloc(10)
+	assert.Nil(t, err)
+	assert.Equal(t, spill.pageID(), h.pageID(), "the next allocation should reuse the just-reclaimed page")
+	assert.Nil(t, s.Write(h, []byte("kept")))
+
+	// Exhaust page 1's remaining slots so the next Alloc has no room in
+	// either page and must go through allocPage().
+	for i := 1; i < slotsPerPage; i++ {
+		_, err := s.Alloc(10)
+		assert.Nil(t, err)
+	}
+	_, err = s.Alloc(10)
+	assert.Nil(t, err)
+
+	b, err := s.Read(h)
+	assert.Nil(t, err)
+	assert.Equal(t, "kept", string(b), "page 1 must not be re-initialized out from under the live allocation at h")
+}
+
+// TestSlab_ConcurrentAllocFreeChurnDoesNotCorruptLongLivedAllocation stress
+// tests Alloc/Write/Free against a real DiskPool-backed Slab: several
+// churner goroutines repeatedly allocate, write and immediately free,
+// forcing lots of page reclaim/reuse traffic, while a long-lived
+// allocation is repeatedly written and read back between rounds of churn.
+// pageSize is shrunk to 128 (vs. NewSlab's default 4096) so pages fill and
+// empty - and DiskPool.Falloc gets called - far more often per iteration.
+// Run with -race: it used to flag DiskPool.Falloc's unsynchronized
+// knownPageCount, and (even without -race) would eventually panic or
+// silently corrupt the long-lived allocation once a churner's Free raced
+// a concurrent Alloc into the same page.
+func TestSlab_ConcurrentAllocFreeChurnDoesNotCorruptLongLivedAllocation(t *testing.T) {
+	fp, err := NewDiskPool(4, t.TempDir())
+	assert.Nil(t, err)
+	s := &Slab{
+		pageSize:  128,
+		framePool: fp,
+		pool:      NewBufferPool(50, fp, BottomEvictor{}),
+		largeRuns: map[int]int{},
+	}
+
+	longLived, err := s.Alloc(20)
+	assert.Nil(t, err)
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				data := []byte(fmt.Sprintf("churn-%02d-%03d", g, r))
+				h, err := s.Alloc(len(data))
+				if err != nil {
+					t.Errorf("Alloc: %v", err)
+					return
+				}
+				if err := s.Write(h, data); err != nil {
+					t.Errorf("Write: %v", err)
+					return
+				}
+				if err := s.Free(h); err != nil {
+					t.Errorf("Free: %v", err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	for r := 0; r < rounds; r++ {
+		data := []byte(fmt.Sprintf("long-lived-%03d", r))
+		assert.Nil(t, s.Write(longLived, data))
+		got, err := s.Read(longLived)
+		assert.Nil(t, err)
+		assert.Equal(t, string(data), string(got))
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,325 @@
+package bufferpool
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// FileType names a category of file a Storage knows how to hold. DiskPool
+// only ever asks for TypePage, but WAL/lock files get their own type so a
+// single Storage can host all of a BufferPool's on-disk state.
+type FileType int
+
+const (
+	TypePage FileType = iota
+	TypeWAL
+	TypeLock
+)
+
+func (t FileType) String() string {
+	switch t {
+	case TypePage:
+		return "page"
+	case TypeWAL:
+		return "wal"
+	case TypeLock:
+		return "LOCK"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// FileDesc identifies one file within a Storage: the Num'th file of kind
+// Type. It deliberately says nothing about where or how that file is
+// held - that's the Storage implementation's job.
+type FileDesc struct {
+	Type FileType
+	Num  int
+}
+
+// Writer is what Storage.Create hands back: something you can write
+// sequentially to, fsync, and close.
+type Writer interface {
+	io.Writer
+	io.Closer
+	Sync() error
+}
+
+// Reader is what Storage.Open hands back: something you can read
+// sequentially or at an offset, and close.
+type Reader interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+// Releaser releases whatever Storage.Lock acquired.
+type Releaser interface {
+	Release()
+}
+
+// Storage decouples FramePool implementations (DiskPool, in principle
+// MmapPool) from the assumption that pages live as files in a directory.
+// Implementations include FileStorage (a real directory), MemStorage (an
+// in-memory double for tests), and LockedStorage (wraps another Storage
+// with single-writer enforcement).
+type Storage interface {
+	Create(FileDesc) (Writer, error)
+	Open(FileDesc) (Reader, error)
+	Remove(FileDesc) error
+	List(FileType) ([]FileDesc, error)
+	Lock() (Releaser, error)
+	Rename(old, new FileDesc) error
+}
+
+// FileStorage implements Storage by keeping one file per FileDesc in a
+// directory, named `<type>_<num>` (the lock file is just `LOCK`).
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage validates that dir exists and is a directory, then
+// returns a Storage backed by files within it.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	s, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+func (o *FileStorage) fileName(fd FileDesc) string {
+	if fd.Type == TypeLock {
+		return path.Join(o.dir, "LOCK")
+	}
+	return path.Join(o.dir, fmt.Sprintf("%s_%d", fd.Type, fd.Num))
+}
+
+func (o *FileStorage) Create(fd FileDesc) (Writer, error) {
+	return os.OpenFile(o.fileName(fd), os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+}
+
+func (o *FileStorage) Open(fd FileDesc) (Reader, error) {
+	return os.Open(o.fileName(fd))
+}
+
+func (o *FileStorage) Remove(fd FileDesc) error {
+	return os.Remove(o.fileName(fd))
+}
+
+func (o *FileStorage) List(t FileType) ([]FileDesc, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := t.String() + "_"
+	var out []FileDesc
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		num, err := strconv.Atoi(strings.TrimPrefix(e.Name(), prefix))
+		if err != nil {
+			continue
+		}
+		out = append(out, FileDesc{Type: t, Num: num})
+	}
+	return out, nil
+}
+
+func (o *FileStorage) Rename(old, new FileDesc) error {
+	return os.Rename(o.fileName(old), o.fileName(new))
+}
+
+type flockReleaser struct {
+	f *os.File
+}
+
+func (r *flockReleaser) Release() {
+	_ = syscall.Flock(int(r.f.Fd()), syscall.LOCK_UN)
+	_ = r.f.Close()
+}
+
+// Lock takes an exclusive, non-blocking OS file lock on this storage's
+// LOCK file, returning an error if another process (or another
+// FileStorage in this process) already holds it.
+func (o *FileStorage) Lock() (Releaser, error) {
+	f, err := os.OpenFile(o.fileName(FileDesc{Type: TypeLock}), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("lock %s: %w", o.dir, err)
+	}
+	return &flockReleaser{f: f}, nil
+}
+
+// memFile is the data behind one FileDesc in a MemStorage.
+type memFile struct {
+	m    sync.Mutex
+	data []byte
+}
+
+type memWriter struct {
+	file *memFile
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.file.m.Lock()
+	defer w.file.m.Unlock()
+	w.file.data = append(w.file.data, p...)
+	return len(p), nil
+}
+func (w *memWriter) Close() error { return nil }
+func (w *memWriter) Sync() error  { return nil }
+
+type memReader struct {
+	file *memFile
+	pos  int64
+}
+
+func (r *memReader) Read(p []byte) (int, error) {
+	r.file.m.Lock()
+	defer r.file.m.Unlock()
+	if r.pos >= int64(len(r.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.file.data[r.pos:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *memReader) ReadAt(p []byte, off int64) (int, error) {
+	r.file.m.Lock()
+	defer r.file.m.Unlock()
+	if off >= int64(len(r.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.file.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *memReader) Close() error { return nil }
+
+// MemStorage is an in-memory Storage, for tests that want FramePool
+// behavior (DiskPool, in particular) without touching a real
+// filesystem - much of what MockPool was used for.
+type MemStorage struct {
+	m      sync.Mutex
+	files  map[FileDesc]*memFile
+	locked bool
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{files: map[FileDesc]*memFile{}}
+}
+
+func (o *MemStorage) Create(fd FileDesc) (Writer, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	f := &memFile{}
+	o.files[fd] = f
+	return &memWriter{file: f}, nil
+}
+
+func (o *MemStorage) Open(fd FileDesc) (Reader, error) {
+	o.m.Lock()
+	f, ok := o.files[fd]
+	o.m.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%v not in storage", fd)
+	}
+	return &memReader{file: f}, nil
+}
+
+func (o *MemStorage) Remove(fd FileDesc) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if _, ok := o.files[fd]; !ok {
+		return fmt.Errorf("%v not in storage", fd)
+	}
+	delete(o.files, fd)
+	return nil
+}
+
+func (o *MemStorage) List(t FileType) ([]FileDesc, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	var out []FileDesc
+	for fd := range o.files {
+		if fd.Type == t {
+			out = append(out, fd)
+		}
+	}
+	return out, nil
+}
+
+func (o *MemStorage) Rename(old, new FileDesc) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	f, ok := o.files[old]
+	if !ok {
+		return fmt.Errorf("%v not in storage", old)
+	}
+	delete(o.files, old)
+	o.files[new] = f
+	return nil
+}
+
+type memReleaser struct {
+	storage *MemStorage
+}
+
+func (r *memReleaser) Release() {
+	r.storage.m.Lock()
+	r.storage.locked = false
+	r.storage.m.Unlock()
+}
+
+func (o *MemStorage) Lock() (Releaser, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.locked {
+		return nil, fmt.Errorf("storage already locked")
+	}
+	o.locked = true
+	return &memReleaser{storage: o}, nil
+}
+
+// LockedStorage wraps a Storage and holds its Lock for as long as the
+// LockedStorage is open, so that only one writer (per process) can use
+// the wrapped Storage at a time. Close releases the lock.
+type LockedStorage struct {
+	Storage
+	releaser Releaser
+}
+
+// NewLockedStorage acquires s.Lock() and returns a Storage that forwards
+// everything else to s.
+func NewLockedStorage(s Storage) (*LockedStorage, error) {
+	r, err := s.Lock()
+	if err != nil {
+		return nil, err
+	}
+	return &LockedStorage{Storage: s, releaser: r}, nil
+}
+
+// Close releases the underlying lock. It does not close the wrapped
+// Storage, which has no such concept.
+func (o *LockedStorage) Close() error {
+	o.releaser.Release()
+	return nil
+}
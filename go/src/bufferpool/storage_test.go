@@ -0,0 +1,115 @@
+package bufferpool
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorage_CreateOpenRemove(t *testing.T) {
+	td := t.TempDir()
+	fs, err := NewFileStorage(td)
+	assert.Nil(t, err)
+
+	desc := FileDesc{Type: TypePage, Num: 0}
+	w, err := fs.Create(desc)
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("abc"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	r, err := fs.Open(desc)
+	assert.Nil(t, err)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(b))
+	assert.Nil(t, r.Close())
+
+	descs, err := fs.List(TypePage)
+	assert.Nil(t, err)
+	assert.Equal(t, []FileDesc{desc}, descs)
+
+	assert.Nil(t, fs.Remove(desc))
+	_, err = fs.Open(desc)
+	assert.Error(t, err)
+}
+
+func TestFileStorage_Lock(t *testing.T) {
+	td := t.TempDir()
+	fs, err := NewFileStorage(td)
+	assert.Nil(t, err)
+
+	r, err := fs.Lock()
+	assert.Nil(t, err)
+	r.Release()
+}
+
+func TestMemStorage_CreateOpenRemove(t *testing.T) {
+	ms := NewMemStorage()
+	desc := FileDesc{Type: TypePage, Num: 3}
+
+	w, err := ms.Create(desc)
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("xyz"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	r, err := ms.Open(desc)
+	assert.Nil(t, err)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "xyz", string(b))
+
+	assert.Nil(t, ms.Remove(desc))
+	_, err = ms.Open(desc)
+	assert.Error(t, err)
+}
+
+func TestMemStorage_Rename(t *testing.T) {
+	ms := NewMemStorage()
+	old := FileDesc{Type: TypePage, Num: 0}
+	newDesc := FileDesc{Type: TypePage, Num: 1}
+
+	w, err := ms.Create(old)
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("data"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, ms.Rename(old, newDesc))
+	_, err = ms.Open(old)
+	assert.Error(t, err)
+
+	r, err := ms.Open(newDesc)
+	assert.Nil(t, err)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "data", string(b))
+}
+
+func TestLockedStorage_SingleWriter(t *testing.T) {
+	ms := NewMemStorage()
+	ls, err := NewLockedStorage(ms)
+	assert.Nil(t, err)
+
+	_, err = ms.Lock()
+	assert.Error(t, err, "a second Lock attempt while LockedStorage holds it should fail")
+
+	assert.Nil(t, ls.Close())
+
+	r, err := ms.Lock()
+	assert.Nil(t, err)
+	r.Release()
+}
+
+func TestDiskPool_ThroughFileStorage(t *testing.T) {
+	td := t.TempDir()
+	dp, err := NewDiskPool(2, td)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dp.Size())
+
+	assert.Nil(t, dp.WriteFrame(0, NewPageFrame([]byte("hi"))))
+	f, err := dp.ReadFrame(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", string(f.frame))
+}
@@ -0,0 +1,169 @@
+package bufferpool
+
+import "fmt"
+
+// Tx is a read or write transaction against a BufferPool, started with
+// BufferPool.Begin. A write Tx shadows its writes in an in-memory
+// overlay and only publishes them - through the backing FramePool, so a
+// WALPool-backed pool logs them - on Commit; Rollback discards the
+// overlay instead. A read Tx takes a stable snapshot by pinning every
+// page it touches against eviction for its lifetime. Exactly one of
+// Commit or Rollback must be called to release the Tx.
+type Tx struct {
+	bp       *BufferPool
+	writable bool
+	// overlay shadows writes for a write Tx, keyed by FramePoolId. Not
+	// used by read txs.
+	overlay map[FramePoolId][]byte
+	// touched records which BufferPoolIds this Tx pinned, so they can be
+	// released (and, for read txs, un-marked as tx-pinned) on Commit or
+	// Rollback.
+	touched map[FramePoolId]BufferPoolId
+	done    bool
+}
+
+// Begin starts a transaction. A writable Tx takes the BufferPool's
+// single-writer lock exclusively, so at most one write Tx is ever in
+// flight; a read Tx takes it for reading, so any number of read txs can
+// run alongside each other (but not alongside a write Tx). BufferPool's
+// own WritePage/AcquirePage/GetPage take the same lock per call, so a
+// direct caller bypassing Tx is still excluded from racing a Tx's
+// overlay/commit.
+func (bp *BufferPool) Begin(writable bool) (*Tx, error) {
+	if writable {
+		bp.txLock.Lock()
+	} else {
+		bp.txLock.RLock()
+	}
+	return &Tx{
+		bp:       bp,
+		writable: writable,
+		overlay:  map[FramePoolId][]byte{},
+		touched:  map[FramePoolId]BufferPoolId{},
+	}, nil
+}
+
+// AcquirePage pins page idx for the duration of the transaction. On a
+// read Tx this also marks the page's BufferPoolId as tx-pinned, so the
+// evictor won't choose it out from under the snapshot before Commit or
+// Rollback. If this Tx has already shadowed a write to idx, the returned
+// page reflects the overlay instead of the shared pool's (pre-commit)
+// data, so a write Tx reads back its own writes.
+func (t *Tx) AcquirePage(idx FramePoolId) (*PageFrame, error) {
+	if t.done {
+		return nil, fmt.Errorf("transaction already finished")
+	}
+	if _, already := t.touched[idx]; already {
+		if shadow, shadowed := t.overlay[idx]; shadowed {
+			return NewPageFrame(shadow), nil
+		}
+		return t.bp.pageForFrame(idx), nil
+	}
+
+	page, err := t.bp.acquirePageTxLocked(idx)
+	if err != nil {
+		return nil, err
+	}
+	bufID := t.bp.frameBufID(idx)
+	t.touched[idx] = bufID
+	if !t.writable {
+		t.bp.markTxPinned(bufID, true)
+	}
+	if shadow, shadowed := t.overlay[idx]; shadowed {
+		return NewPageFrame(shadow), nil
+	}
+	return page, nil
+}
+
+// WritePage shadows a write to page idx in the transaction's overlay; it
+// is not visible to other readers of the BufferPool (or durable) until
+// Commit.
+func (t *Tx) WritePage(idx FramePoolId, data []byte) error {
+	if !t.writable {
+		return fmt.Errorf("write on a read-only transaction")
+	}
+	if t.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	if _, err := t.AcquirePage(idx); err != nil {
+		return err
+	}
+	shadow := make([]byte, len(data))
+	copy(shadow, data)
+	t.overlay[idx] = shadow
+	return nil
+}
+
+// Commit publishes a write Tx's overlay into the shared pages and
+// flushes each changed page through the backing FramePool (which, if it
+// is a WALPool, logs the write before applying it), then releases the
+// Tx. A read Tx has no overlay to publish; Commit just releases it.
+//
+// The whole overlay is applied in memory before any page is flushed, and
+// flushing stops at the first failure: since a write Tx holds the
+// BufferPool's single-writer lock for its entire lifetime, no other
+// writer can observe a partially-applied overlay, and a flush failure
+// leaves every prior page in this Tx durably written with only the
+// remainder pending - it does not leave some pages committed and others
+// silently reverted. The offending FramePoolId is named in the returned
+// error so the caller knows where the commit stopped.
+func (t *Tx) Commit() error {
+	if t.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	if t.writable {
+		pages := make(map[FramePoolId]*PageFrame, len(t.overlay))
+		for idx := range t.overlay {
+			pages[idx] = t.bp.pageForFrame(idx)
+		}
+		for idx, data := range t.overlay {
+			page := pages[idx]
+			if err := page.WithWrite(func(b *[]byte) error {
+				*b = data
+				return nil
+			}); err != nil {
+				t.release()
+				return err
+			}
+		}
+		flushed := 0
+		for idx, page := range pages {
+			if err := FSyncSlot(page, t.bp, idx); err != nil {
+				t.release()
+				return fmt.Errorf("commit: flush of frame %v failed after %d of %d pages flushed: %w", idx, flushed, len(pages), err)
+			}
+			flushed++
+		}
+	}
+	t.release()
+	return nil
+}
+
+// Rollback discards a write Tx's overlay without ever touching the
+// shared pages, and releases the Tx. For a read Tx it is equivalent to
+// Commit - there was nothing to publish either way.
+func (t *Tx) Rollback() error {
+	if t.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	t.overlay = nil
+	t.release()
+	return nil
+}
+
+// release unpins every page the Tx touched, clears any tx-pinned marks
+// it set, and gives up the BufferPool's single-writer/multi-reader lock.
+func (t *Tx) release() {
+	for idx, bufID := range t.touched {
+		if !t.writable {
+			t.bp.markTxPinned(bufID, false)
+		}
+		_ = t.bp.releasePageTxLocked(idx)
+	}
+	t.done = true
+	if t.writable {
+		t.bp.txLock.Unlock()
+	} else {
+		t.bp.txLock.RUnlock()
+	}
+}
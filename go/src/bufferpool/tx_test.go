@@ -0,0 +1,139 @@
+package bufferpool
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferPool_WriteTxCommitPublishesOverlay(t *testing.T) {
+	bp := NewBufferPool(3, NewMockPool(3), BottomEvictor{})
+
+	tx, err := bp.Begin(true)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.WritePage(0, []byte("committed")))
+	assert.Nil(t, tx.Commit())
+
+	page, err := bp.AcquirePage(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "committed", string(page.DataClone()))
+	assert.Nil(t, bp.ReleasePage(0))
+}
+
+// TestBufferPool_WriteTxReadsItsOwnWrites guards against AcquirePage
+// bypassing the overlay on read: within a single write Tx, reading a page
+// back after writing it must see the shadowed value, not the shared
+// pool's stale pre-commit data.
+func TestBufferPool_WriteTxReadsItsOwnWrites(t *testing.T) {
+	bp := NewBufferPool(3, NewMockPool(3), BottomEvictor{})
+	assert.Nil(t, bp.WritePage(0, []byte("original")))
+
+	tx, err := bp.Begin(true)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.WritePage(0, []byte("new-value")))
+
+	page, err := tx.AcquirePage(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "new-value", string(page.DataClone()))
+
+	assert.Nil(t, tx.Commit())
+}
+
+func TestBufferPool_WriteTxRollbackDiscardsOverlay(t *testing.T) {
+	bp := NewBufferPool(3, NewMockPool(3), BottomEvictor{})
+	assert.Nil(t, bp.WritePage(0, []byte("original")))
+
+	tx, err := bp.Begin(true)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.WritePage(0, []byte("should not stick")))
+	assert.Nil(t, tx.Rollback())
+
+	page, err := bp.AcquirePage(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "original", string(page.DataClone()))
+	assert.Nil(t, bp.ReleasePage(0))
+}
+
+func TestBufferPool_ReadTxPinsAgainstEviction(t *testing.T) {
+	bp := NewBufferPool(2, NewMockPool(4), BottomEvictor{})
+	assert.Nil(t, bp.WritePage(0, []byte("kept")))
+	assert.Nil(t, bp.WritePage(1, []byte("also-loaded")))
+
+	tx, err := bp.Begin(false)
+	assert.Nil(t, err)
+	_, err = tx.AcquirePage(0)
+	assert.Nil(t, err)
+
+	// The pool is now full (size 2) with both 0 and 1 loaded; loading a
+	// third page forces an eviction. tx.AcquirePage(0) just moved 0 to the
+	// top of the lru, so BottomEvictor picks 1, and 0 - which the read tx
+	// has pinned and snapshotted - must stay loaded. This goes through tx
+	// rather than bp.WritePage, since bp.WritePage now takes the same
+	// txLock the open read Tx is holding for reading.
+	_, err = tx.AcquirePage(2)
+	assert.Nil(t, err)
+
+	page, err := tx.AcquirePage(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "kept", string(page.DataClone()))
+
+	assert.Nil(t, tx.Commit())
+}
+
+func TestBufferPool_WriteTxPinsAgainstEviction(t *testing.T) {
+	bp := NewBufferPool(2, NewMockPool(4), BottomEvictor{})
+	assert.Nil(t, bp.WritePage(0, []byte("kept")))
+	assert.Nil(t, bp.WritePage(1, []byte("also-loaded")))
+
+	tx, err := bp.Begin(true)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.WritePage(0, []byte("overlaid")))
+
+	// The pool is now full (size 2) with both 0 and 1 loaded; loading a
+	// third page forces an eviction. tx.WritePage(0) pinned 0 via
+	// AcquirePage and moved it to the top of the lru, so BottomEvictor picks
+	// 1, and 0's overlaid write must survive to Commit. This goes through
+	// tx rather than bp.WritePage,
+	// since bp.WritePage now takes the same single-writer txLock the open
+	// write Tx is holding.
+	assert.Nil(t, tx.WritePage(2, []byte("forces-eviction")))
+
+	assert.Nil(t, tx.Commit())
+
+	page, err := bp.AcquirePage(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "overlaid", string(page.DataClone()))
+	assert.Nil(t, bp.ReleasePage(0))
+}
+
+func TestBufferPool_WriteTxExcludesOtherWriters(t *testing.T) {
+	bp := NewBufferPool(3, NewMockPool(3), BottomEvictor{})
+
+	tx, err := bp.Begin(true)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		close(started)
+		tx2, err := bp.Begin(true)
+		assert.Nil(t, err)
+		close(done)
+		assert.Nil(t, tx2.Commit())
+	}()
+
+	<-started
+	select {
+	case <-done:
+		t.Fatal("second write Tx began while the first was still open")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Nil(t, tx.Commit())
+	wg.Wait()
+}
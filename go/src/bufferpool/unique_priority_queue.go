@@ -0,0 +1,166 @@
+package bufferpool
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+
+	"golang.org/x/exp/constraints"
+)
+
+// PQMode selects whether a UniquePriorityQueue pops the smallest or the
+// largest priority first.
+type PQMode int
+
+const (
+	MinHeap PQMode = iota
+	MaxHeap
+)
+
+// UniquePriorityQueue is a priority queue with the same uniqueness
+// guarantee as UniqueStack: a key is never present twice. Unlike
+// UniqueStack (which orders purely by recency), ordering here is by an
+// explicit priority P. Internally it's a container/heap plus an index map,
+// so Push on an existing key is a heap.Fix (O(log n)) rather than a
+// delete-and-reinsert, and Delete(k) is also O(log n).
+// Access is gated by a RWMutex, matching UniqueStack.
+type UniquePriorityQueue[K comparable, P constraints.Ordered] struct {
+	h     *pqHeap[K, P]
+	index map[K]*pqItem[K, P]
+	m     sync.RWMutex
+}
+
+type pqItem[K comparable, P constraints.Ordered] struct {
+	key      K
+	priority P
+	pos      int
+}
+
+// pqHeap implements container/heap.Interface over pqItems. less encodes
+// the MinHeap/MaxHeap choice made at construction.
+type pqHeap[K comparable, P constraints.Ordered] struct {
+	items []*pqItem[K, P]
+	less  func(a, b P) bool
+}
+
+func (h pqHeap[K, P]) Len() int { return len(h.items) }
+
+func (h pqHeap[K, P]) Less(i, j int) bool {
+	return h.less(h.items[i].priority, h.items[j].priority)
+}
+
+func (h pqHeap[K, P]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].pos = i
+	h.items[j].pos = j
+}
+
+func (h *pqHeap[K, P]) Push(x any) {
+	item := x.(*pqItem[K, P])
+	item.pos = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *pqHeap[K, P]) Pop() any {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	h.items = old[:n-1]
+	return item
+}
+
+// NewUniquePriorityQueue builds an empty UniquePriorityQueue. mode chooses
+// whether Peek/Pop surface the minimum or the maximum priority first.
+func NewUniquePriorityQueue[K comparable, P constraints.Ordered](mode PQMode) *UniquePriorityQueue[K, P] {
+	less := func(a, b P) bool { return a < b }
+	if mode == MaxHeap {
+		less = func(a, b P) bool { return a > b }
+	}
+	return &UniquePriorityQueue[K, P]{
+		h:     &pqHeap[K, P]{less: less},
+		index: map[K]*pqItem[K, P]{},
+	}
+}
+
+// Length returns the number of keys currently in the queue.
+func (o *UniquePriorityQueue[K, P]) Length() int {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return len(o.index)
+}
+
+// Contains reports whether k is currently in the queue.
+func (o *UniquePriorityQueue[K, P]) Contains(k K) bool {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	_, ok := o.index[k]
+	return ok
+}
+
+// Push inserts k at priority p, or, if k is already present, re-priorities
+// it in place via heap.Fix.
+func (o *UniquePriorityQueue[K, P]) Push(k K, p P) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if item, ok := o.index[k]; ok {
+		item.priority = p
+		heap.Fix(o.h, item.pos)
+		return
+	}
+	item := &pqItem[K, P]{key: k, priority: p}
+	o.index[k] = item
+	heap.Push(o.h, item)
+}
+
+// Update sets k's priority and re-heapifies. It returns an error if k is
+// not present; use Push to insert-or-update.
+func (o *UniquePriorityQueue[K, P]) Update(k K, p P) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	item, ok := o.index[k]
+	if !ok {
+		return fmt.Errorf("element %v not found in priority queue", k)
+	}
+	item.priority = p
+	heap.Fix(o.h, item.pos)
+	return nil
+}
+
+// Delete removes k from the queue.
+func (o *UniquePriorityQueue[K, P]) Delete(k K) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	item, ok := o.index[k]
+	if !ok {
+		return fmt.Errorf("element %v not found in priority queue", k)
+	}
+	heap.Remove(o.h, item.pos)
+	delete(o.index, k)
+	return nil
+}
+
+// Peek returns the key and priority at the front of the queue without
+// removing it. ok is false if the queue is empty.
+func (o *UniquePriorityQueue[K, P]) Peek() (k K, p P, ok bool) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	if len(o.h.items) == 0 {
+		return k, p, false
+	}
+	top := o.h.items[0]
+	return top.key, top.priority, true
+}
+
+// Pop removes and returns the key and priority at the front of the queue.
+// ok is false if the queue is empty.
+func (o *UniquePriorityQueue[K, P]) Pop() (k K, p P, ok bool) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if len(o.h.items) == 0 {
+		return k, p, false
+	}
+	item := heap.Pop(o.h).(*pqItem[K, P])
+	delete(o.index, item.key)
+	return item.key, item.priority, true
+}
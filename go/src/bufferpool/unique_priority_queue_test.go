@@ -0,0 +1,93 @@
+package bufferpool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniquePriorityQueue_MinHeapOrdering(t *testing.T) {
+	pq := NewUniquePriorityQueue[string, int](MinHeap)
+	pq.Push("c", 3)
+	pq.Push("a", 1)
+	pq.Push("b", 2)
+	assert.Equal(t, 3, pq.Length())
+
+	k, p, ok := pq.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "a", k)
+	assert.Equal(t, 1, p)
+
+	k, _, ok = pq.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+
+	k, _, ok = pq.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "c", k)
+
+	_, _, ok = pq.Pop()
+	assert.False(t, ok)
+}
+
+func TestUniquePriorityQueue_MaxHeapOrdering(t *testing.T) {
+	pq := NewUniquePriorityQueue[string, int](MaxHeap)
+	pq.Push("a", 1)
+	pq.Push("c", 3)
+	pq.Push("b", 2)
+
+	k, _, ok := pq.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "c", k)
+}
+
+func TestUniquePriorityQueue_PushOnExistingKeyReprioritizes(t *testing.T) {
+	pq := NewUniquePriorityQueue[string, int](MinHeap)
+	pq.Push("a", 5)
+	pq.Push("b", 10)
+	assert.Equal(t, 2, pq.Length())
+
+	pq.Push("b", 1)
+	assert.Equal(t, 2, pq.Length(), "re-pushing an existing key must not grow the queue")
+
+	k, p, ok := pq.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+	assert.Equal(t, 1, p)
+}
+
+func TestUniquePriorityQueue_Update(t *testing.T) {
+	pq := NewUniquePriorityQueue[string, int](MinHeap)
+	assert.Error(t, pq.Update("missing", 1))
+
+	pq.Push("a", 5)
+	assert.Nil(t, pq.Update("a", 0))
+	k, p, ok := pq.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "a", k)
+	assert.Equal(t, 0, p)
+}
+
+func TestUniquePriorityQueue_Delete(t *testing.T) {
+	pq := NewUniquePriorityQueue[string, int](MinHeap)
+	assert.Error(t, pq.Delete("missing"))
+
+	pq.Push("a", 1)
+	pq.Push("b", 2)
+	assert.Nil(t, pq.Delete("a"))
+	assert.False(t, pq.Contains("a"))
+	assert.Equal(t, 1, pq.Length())
+
+	k, _, ok := pq.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+}
+
+func TestUniquePriorityQueue_PeekDoesNotRemove(t *testing.T) {
+	pq := NewUniquePriorityQueue[string, int](MinHeap)
+	pq.Push("a", 1)
+
+	_, _, ok := pq.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, 1, pq.Length())
+}
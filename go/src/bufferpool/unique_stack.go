@@ -1,33 +1,130 @@
 package bufferpool
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
 
 // / UniqueStack is a Priority Queue / Stack that has a Uniqueness property.
-// / Internally this is implemented by ~ 2*n elements
-// / Reprioritizations (by "Push existing element") are slow (they involve, effectively, a delete).
-// / Top, Bottom, Pop are all reasonably fast.
+// / Internally this is an intrusive doubly-linked list plus a map (the
+// / classic LRU-cache shape), so Push (new or existing), Delete, Pop, Top,
+// / and Bottom are all O(1). Reprioritizing an existing element ("Push
+// / existing element") is therefore just as cheap as inserting a new one.
+// / OrderedRead is O(n): it materializes a snapshot, so pay for it only
+// / when you actually need to see the whole order.
 // / Access to the Stack is gated by a RWMutex.
 type UniqueStack[K comparable] struct {
-	// This is a pretty bad implementation internally.
-	// It should be a tree without dupes. I hate writing rotations for tree algorithms...
-
-	// TODO: make Data, Order private.
-	Data  map[K]bool
-	Order []K
+	nodes map[K]*uniqueStackNode[K]
+	// head and tail are sentinels and never hold a caller's key. The list
+	// runs head -> bottom ... top -> tail.
+	head *uniqueStackNode[K]
+	tail *uniqueStackNode[K]
+	// capacity is 0 for an unbounded stack, otherwise Push evicts the
+	// bottom element once len(nodes) would exceed it.
+	capacity int
+	onEvict  func(K)
 	// TODO: move the mutex to a variable to be inaccessible and
 	// the API fully thread-safe
 	m sync.RWMutex
+	// cond is signaled whenever an element is pushed, so PopWait can block
+	// until there's something to pop instead of spinning. It shares o.m's
+	// write lock as its Locker.
+	cond *sync.Cond
+}
+
+type uniqueStackNode[K comparable] struct {
+	key        K
+	prev, next *uniqueStackNode[K]
 }
 
 func NewUniqueStack[K comparable]() *UniqueStack[K] {
-	return &UniqueStack[K]{
-		Data:  map[K]bool{},
-		Order: []K{},
+	head := &uniqueStackNode[K]{}
+	tail := &uniqueStackNode[K]{}
+	head.next = tail
+	tail.prev = head
+	o := &UniqueStack[K]{
+		nodes: map[K]*uniqueStackNode[K]{},
+		head:  head,
+		tail:  tail,
 	}
+	o.cond = sync.NewCond(&o.m)
+	return o
+}
+
+// NewBoundedUniqueStack builds a UniqueStack that behaves as an LRU cache:
+// once Push would grow it past cap, the bottom (least-recently-pushed)
+// element is evicted and passed to onEvict. onEvict is invoked outside the
+// stack's internal lock, so it may safely call back into this stack (e.g.
+// to re-Push the evicted key elsewhere) without deadlocking. onEvict may be
+// nil if the caller doesn't need to observe evictions.
+func NewBoundedUniqueStack[K comparable](cap int, onEvict func(K)) *UniqueStack[K] {
+	o := NewUniqueStack[K]()
+	o.capacity = cap
+	o.onEvict = onEvict
+	return o
+}
+
+// Cap returns the configured maximum size. A value of 0 or less means the
+// stack is unbounded.
+func (o *UniqueStack[K]) Cap() int {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	return o.capacity
+}
 
+// Contains reports whether e is currently in the stack.
+func (o *UniqueStack[K]) Contains(e K) bool {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	_, ok := o.nodes[e]
+	return ok
+}
+
+// Resize changes the capacity to n. If the stack currently holds more than
+// n elements, the bottom ones are evicted, in order, until it doesn't;
+// onEvict (if set) is called for each, outside the lock. n <= 0 means
+// unbounded.
+func (o *UniqueStack[K]) Resize(n int) {
+	o.m.Lock()
+	o.capacity = n
+	evicted := o.evictToCapacityLocked()
+	o.m.Unlock()
+	o.fireEvictions(evicted)
+}
+
+// popBottomLocked removes and returns the bottom node's key. Caller must
+// hold o.m for writing and must have already checked the stack is non-empty.
+func (o *UniqueStack[K]) popBottomLocked() K {
+	n := o.head.next
+	o.unlink(n)
+	delete(o.nodes, n.key)
+	return n.key
+}
+
+// evictToCapacityLocked pops from the bottom until len(nodes) <= capacity
+// (a no-op when capacity <= 0) and returns the evicted keys in eviction
+// order. Caller must hold o.m for writing.
+func (o *UniqueStack[K]) evictToCapacityLocked() []K {
+	if o.capacity <= 0 {
+		return nil
+	}
+	var evicted []K
+	for len(o.nodes) > o.capacity {
+		evicted = append(evicted, o.popBottomLocked())
+	}
+	return evicted
+}
+
+// fireEvictions calls onEvict for each key, in order. Must be called with
+// o.m NOT held.
+func (o *UniqueStack[K]) fireEvictions(evicted []K) {
+	if o.onEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		o.onEvict(e)
+	}
 }
 
 // With takes a *UniqueStack, a new element, and returns a new *UniqueStack with the new element.
@@ -36,89 +133,250 @@ func (o *UniqueStack[K]) With(e K) *UniqueStack[K] {
 	return o
 }
 
+// unlink removes n from the list. Caller must hold o.m for writing.
+func (o *UniqueStack[K]) unlink(n *uniqueStackNode[K]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+}
+
+// pushTop splices n in immediately below the tail sentinel, i.e. onto the
+// top of the stack. Caller must hold o.m for writing.
+func (o *UniqueStack[K]) pushTop(n *uniqueStackNode[K]) {
+	n.prev = o.tail.prev
+	n.next = o.tail
+	o.tail.prev.next = n
+	o.tail.prev = n
+}
+
 // OrderedRead returns the elements in the stack in order from bottom to top.
 func (o *UniqueStack[K]) OrderedRead() []K {
 	o.m.RLock()
 	defer o.m.RUnlock()
-	return o.Order
+	out := make([]K, 0, len(o.nodes))
+	for n := o.head.next; n != o.tail; n = n.next {
+		out = append(out, n.key)
+	}
+	return out
 }
 
 func (o *UniqueStack[K]) Length() int {
 	o.m.RLock()
 	defer o.m.RUnlock()
-	return len(o.Order)
+	return len(o.nodes)
 }
 
 func (o *UniqueStack[K]) Push(e K) {
 	o.m.Lock()
-	defer o.m.Unlock()
-	if _, ok := o.Data[e]; !ok {
-		// Don't have. Push onto the top
-		o.Order = append(o.Order, e)
-		o.Data[e] = true
-	} else {
-		// Do have. Delete from current location, move to top.
-		// Precondition: the element is in o.Order
-		idx := 0
-		for i := 0; i < len(o.Order); i++ {
-			if o.Order[i] == e {
-				idx = i
-				break
-			}
-		}
-
-		o.Order = append(o.Order[:idx], o.Order[idx+1:]...)
-		o.Order = append(o.Order, e)
+	if n, ok := o.nodes[e]; ok {
+		// Do have. Move to top.
+		o.unlink(n)
+		o.pushTop(n)
+		o.m.Unlock()
+		return
 	}
+	// Don't have. Push onto the top.
+	n := &uniqueStackNode[K]{key: e}
+	o.nodes[e] = n
+	o.pushTop(n)
+	evicted := o.evictToCapacityLocked()
+	o.cond.Signal()
+	o.m.Unlock()
+	o.fireEvictions(evicted)
 }
 
-// Deletes e from the UniqueStack o. The order is stable.
+// Deletes e from the UniqueStack o. The order of the remaining elements is stable.
 func (o *UniqueStack[K]) Delete(e K) error {
 	o.m.Lock()
 	defer o.m.Unlock()
-	if _, ok := o.Data[e]; ok {
-		// Do have. Delete from current location, move to top.
-		// Precondition for success: the element is in o.Order
-		var idx *int
-		idx = new(int)
-		*idx = 0
-		for i := 0; i < len(o.Order); i++ {
-			if o.Order[i] == e {
-				*idx = i
-				break
-			}
-		}
-		// inconsistency check; if existed in Data but not Order...
-		if idx == nil {
-			return fmt.Errorf("significant inconsistency error: element %v not found in stack", e)
-		}
-
-		o.Order = append(o.Order[:*idx], o.Order[*idx+1:]...)
-		delete(o.Data, e)
-	} else {
+	n, ok := o.nodes[e]
+	if !ok {
 		return fmt.Errorf("element %v not found in stack", e)
 	}
+	o.unlink(n)
+	delete(o.nodes, e)
 	return nil
 }
 
 func (o *UniqueStack[K]) Pop() K {
 	o.m.Lock()
 	defer o.m.Unlock()
-	sz := len(o.Order)
-	end := o.Order[sz-1]
-	delete(o.Data, end)
-	o.Order = o.Order[:sz-1]
-	return end
+	if len(o.nodes) == 0 {
+		panic("UniqueStack.Pop: stack is empty")
+	}
+	n := o.tail.prev
+	o.unlink(n)
+	delete(o.nodes, n.key)
+	return n.key
 }
 
 func (o *UniqueStack[K]) Top() K {
 	o.m.RLock()
 	defer o.m.RUnlock()
-	return o.Order[len(o.Order)-1]
+	if len(o.nodes) == 0 {
+		panic("UniqueStack.Top: stack is empty")
+	}
+	return o.tail.prev.key
 }
 
 func (o *UniqueStack[K]) Bottom() K {
 	o.m.RLock()
 	defer o.m.RUnlock()
-	return o.Order[0]
+	if len(o.nodes) == 0 {
+		panic("UniqueStack.Bottom: stack is empty")
+	}
+	return o.head.next.key
+}
+
+// TryPop removes and returns the top element. ok is false, and the zero
+// value of K is returned, if the stack is empty - unlike Pop, it never
+// panics.
+func (o *UniqueStack[K]) TryPop() (k K, ok bool) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if len(o.nodes) == 0 {
+		return k, false
+	}
+	n := o.tail.prev
+	o.unlink(n)
+	delete(o.nodes, n.key)
+	return n.key, true
+}
+
+// TryTop returns the top element without removing it. ok is false if the
+// stack is empty - unlike Top, it never panics.
+func (o *UniqueStack[K]) TryTop() (k K, ok bool) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	if len(o.nodes) == 0 {
+		return k, false
+	}
+	return o.tail.prev.key, true
+}
+
+// TryBottom returns the bottom element without removing it. ok is false if
+// the stack is empty - unlike Bottom, it never panics.
+func (o *UniqueStack[K]) TryBottom() (k K, ok bool) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	if len(o.nodes) == 0 {
+		return k, false
+	}
+	return o.head.next.key, true
+}
+
+// PopN pops up to n elements from the top, returning them in pop order
+// (most-recently-pushed first). It stops early, returning fewer than n
+// elements, if the stack empties first.
+func (o *UniqueStack[K]) PopN(n int) []K {
+	o.m.Lock()
+	defer o.m.Unlock()
+	out := make([]K, 0, n)
+	for i := 0; i < n && len(o.nodes) > 0; i++ {
+		top := o.tail.prev
+		o.unlink(top)
+		delete(o.nodes, top.key)
+		out = append(out, top.key)
+	}
+	return out
+}
+
+// PushFront inserts e at the bottom of the stack if it's not already
+// present, or moves it to the bottom if it is. Combined with Pop (which
+// takes from the top), this lets UniqueStack double as a FIFO queue;
+// combined with PopFront, as a plain deque.
+func (o *UniqueStack[K]) PushFront(e K) {
+	o.m.Lock()
+	if n, ok := o.nodes[e]; ok {
+		// Do have. Move to bottom.
+		o.unlink(n)
+		o.pushBottom(n)
+		o.m.Unlock()
+		return
+	}
+	// Don't have. Push onto the bottom.
+	n := &uniqueStackNode[K]{key: e}
+	o.nodes[e] = n
+	o.pushBottom(n)
+	evicted := o.evictToCapacityLocked()
+	o.cond.Signal()
+	o.m.Unlock()
+	o.fireEvictions(evicted)
+}
+
+// pushBottom splices n in immediately after the head sentinel, i.e. onto
+// the bottom of the stack. Caller must hold o.m for writing.
+func (o *UniqueStack[K]) pushBottom(n *uniqueStackNode[K]) {
+	n.next = o.head.next
+	n.prev = o.head
+	o.head.next.prev = n
+	o.head.next = n
+}
+
+// PopFront removes and returns the bottom element. Like Pop, it panics if
+// the stack is empty; see TryBottom for a non-panicking check.
+func (o *UniqueStack[K]) PopFront() K {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if len(o.nodes) == 0 {
+		panic("UniqueStack.PopFront: stack is empty")
+	}
+	return o.popBottomLocked()
+}
+
+// Exists reports whether e is currently in the stack. It's an alias for
+// Contains, kept so callers thinking in deque/ordered-set terms don't have
+// to reach into the stack's internals to check membership.
+func (o *UniqueStack[K]) Exists(e K) bool {
+	return o.Contains(e)
+}
+
+// Iterate walks the stack from bottom to top under the read lock, calling
+// f for each element. It stops early if f returns false.
+func (o *UniqueStack[K]) Iterate(f func(K) bool) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	for n := o.head.next; n != o.tail; n = n.next {
+		if !f(n.key) {
+			return
+		}
+	}
+}
+
+// PopWait blocks until an element is available to pop, or ctx is done,
+// whichever comes first. It's meant for worker/dispatch pools consuming
+// from a UniqueStack, so they can wait for work rather than spin on
+// TryPop.
+func (o *UniqueStack[K]) PopWait(ctx context.Context) (K, error) {
+	// stop tells the watcher goroutine below to give up once we return;
+	// cancelled is the one-way signal it sends back when ctx fires first.
+	stop := make(chan struct{})
+	defer close(stop)
+	cancelled := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			o.m.Lock()
+			close(cancelled)
+			o.cond.Broadcast()
+			o.m.Unlock()
+		case <-stop:
+		}
+	}()
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	var zero K
+	for len(o.nodes) == 0 {
+		select {
+		case <-cancelled:
+			return zero, ctx.Err()
+		default:
+		}
+		o.cond.Wait()
+	}
+	n := o.tail.prev
+	o.unlink(n)
+	delete(o.nodes, n.key)
+	return n.key, nil
 }
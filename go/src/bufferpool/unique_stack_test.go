@@ -1,8 +1,10 @@
 package bufferpool
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -101,3 +103,219 @@ func TestUniqueStack_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestBoundedUniqueStack_EvictsBottomOnOverflow(t *testing.T) {
+	var evicted []int
+	us := NewBoundedUniqueStack[int](3, func(k int) { evicted = append(evicted, k) })
+
+	us.Push(1)
+	us.Push(2)
+	us.Push(3)
+	assert.Equal(t, 3, us.Length())
+	assert.Nil(t, evicted)
+
+	us.Push(4)
+	assert.Equal(t, 3, us.Length())
+	assert.Equal(t, []int{1}, evicted)
+	assert.Equal(t, []int{2, 3, 4}, us.OrderedRead())
+
+	// Re-pushing an existing key just reprioritizes; it must not evict.
+	us.Push(2)
+	assert.Equal(t, []int{1}, evicted)
+	assert.Equal(t, []int{3, 4, 2}, us.OrderedRead())
+}
+
+func TestUniqueStack_Contains(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2)
+	assert.True(t, us.Contains(1))
+	assert.False(t, us.Contains(3))
+	assert.Nil(t, us.Delete(1))
+	assert.False(t, us.Contains(1))
+}
+
+func TestUniqueStack_Cap(t *testing.T) {
+	us := NewUniqueStack[int]()
+	assert.Equal(t, 0, us.Cap())
+
+	bounded := NewBoundedUniqueStack[int](5, nil)
+	assert.Equal(t, 5, bounded.Cap())
+}
+
+func TestUniqueStack_ResizeEvictsInOrder(t *testing.T) {
+	var evicted []int
+	us := NewBoundedUniqueStack[int](5, func(k int) { evicted = append(evicted, k) })
+	for i := 1; i <= 5; i++ {
+		us.Push(i)
+	}
+
+	us.Resize(2)
+	assert.Equal(t, 2, us.Cap())
+	assert.Equal(t, []int{1, 2, 3}, evicted)
+	assert.Equal(t, []int{4, 5}, us.OrderedRead())
+
+	// Growing back doesn't evict anything.
+	us.Resize(10)
+	assert.Equal(t, []int{1, 2, 3}, evicted)
+}
+
+func TestUniqueStack_TryPopOnEmptyDoesNotPanic(t *testing.T) {
+	us := NewUniqueStack[int]()
+	_, ok := us.TryPop()
+	assert.False(t, ok)
+	_, ok = us.TryTop()
+	assert.False(t, ok)
+	_, ok = us.TryBottom()
+	assert.False(t, ok)
+}
+
+func TestUniqueStack_TopBottomPopPanicOnEmpty(t *testing.T) {
+	us := NewUniqueStack[int]()
+	assert.Panics(t, func() { us.Top() })
+	assert.Panics(t, func() { us.Bottom() })
+	assert.Panics(t, func() { us.Pop() })
+	assert.Panics(t, func() { us.PopFront() })
+}
+
+func TestUniqueStack_TryPopReturnsTop(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2)
+	k, ok := us.TryTop()
+	assert.True(t, ok)
+	assert.Equal(t, 2, k)
+
+	k, ok = us.TryBottom()
+	assert.True(t, ok)
+	assert.Equal(t, 1, k)
+
+	k, ok = us.TryPop()
+	assert.True(t, ok)
+	assert.Equal(t, 2, k)
+	assert.Equal(t, 1, us.Length())
+}
+
+func TestUniqueStack_PopN(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2).With(3)
+	got := us.PopN(2)
+	assert.Equal(t, []int{3, 2}, got)
+	assert.Equal(t, 1, us.Length())
+
+	// Asking for more than remain stops early rather than panicking.
+	got = us.PopN(5)
+	assert.Equal(t, []int{1}, got)
+	assert.Equal(t, 0, us.Length())
+}
+
+func TestUniqueStack_PopWaitReturnsImmediatelyWhenNonEmpty(t *testing.T) {
+	us := NewUniqueStack[int]().With(1)
+	k, err := us.PopWait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, k)
+}
+
+func TestUniqueStack_PopWaitUnblocksOnPush(t *testing.T) {
+	us := NewUniqueStack[int]()
+	result := make(chan int, 1)
+	go func() {
+		k, err := us.PopWait(context.Background())
+		assert.Nil(t, err)
+		result <- k
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	us.Push(42)
+
+	select {
+	case k := <-result:
+		assert.Equal(t, 42, k)
+	case <-time.After(time.Second):
+		t.Fatal("PopWait did not unblock after Push")
+	}
+}
+
+func TestUniqueStack_PopWaitRespectsContextCancellation(t *testing.T) {
+	us := NewUniqueStack[int]()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := us.PopWait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestUniqueStack_PushFrontInsertsAtBottom(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2)
+	us.PushFront(3)
+	assert.Equal(t, []int{3, 1, 2}, us.OrderedRead())
+}
+
+func TestUniqueStack_PushFrontMovesExistingToBottom(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2).With(3)
+	us.PushFront(2)
+	assert.Equal(t, []int{2, 1, 3}, us.OrderedRead())
+	assert.Equal(t, 3, us.Length(), "PushFront on an existing key must not duplicate it")
+}
+
+func TestBoundedUniqueStack_PushFrontEvictsOnOverflow(t *testing.T) {
+	var evicted []int
+	us := NewBoundedUniqueStack[int](3, func(k int) { evicted = append(evicted, k) })
+
+	for i := 1; i <= 5; i++ {
+		us.PushFront(i)
+	}
+	assert.Equal(t, 3, us.Length(), "PushFront must respect capacity, same as Push")
+	assert.NotNil(t, evicted, "PushFront must fire onEvict when it overflows capacity")
+}
+
+func TestUniqueStack_PopFront(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2)
+	k := us.PopFront()
+	assert.Equal(t, 1, k)
+	assert.Equal(t, []int{2}, us.OrderedRead())
+}
+
+func TestUniqueStack_Exists(t *testing.T) {
+	us := NewUniqueStack[int]().With(1)
+	assert.True(t, us.Exists(1))
+	assert.False(t, us.Exists(2))
+}
+
+func TestUniqueStack_Iterate(t *testing.T) {
+	us := NewUniqueStack[int]().With(1).With(2).With(3)
+
+	var seen []int
+	us.Iterate(func(k int) bool {
+		seen = append(seen, k)
+		return true
+	})
+	assert.Equal(t, []int{1, 2, 3}, seen)
+
+	seen = nil
+	us.Iterate(func(k int) bool {
+		seen = append(seen, k)
+		return k != 2
+	})
+	assert.Equal(t, []int{1, 2}, seen, "Iterate should stop as soon as f returns false")
+}
+
+// BenchmarkUniqueStack_PushNew measures repeatedly pushing fresh keys.
+func BenchmarkUniqueStack_PushNew(b *testing.B) {
+	us := NewUniqueStack[int]()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		us.Push(i)
+	}
+}
+
+// BenchmarkUniqueStack_PushExisting measures the "reprioritize a hot key"
+// path: with the doubly-linked-list backend this is O(1) regardless of how
+// many other keys are in the stack, whereas the old slice backend scanned
+// and spliced Order on every call.
+func BenchmarkUniqueStack_PushExisting(b *testing.B) {
+	const n = 10000
+	us := NewUniqueStack[int]()
+	for i := 0; i < n; i++ {
+		us.Push(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		us.Push(0)
+	}
+}
@@ -0,0 +1,249 @@
+package bufferpool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// recordHeaderSize is the fixed-width portion of a WAL record: an 8 byte
+// LSN, an 8 byte FrameID, and a 4 byte payload length.
+const recordHeaderSize = 8 + 8 + 4
+
+// WALRecord is a single logged mutation: frame `FrameID` should be
+// overwritten with `Data` once LSN `LSN` is considered applied.
+type WALRecord struct {
+	LSN     uint64
+	FrameID int
+	Data    []byte
+}
+
+// WALPool wraps a FramePool with a write-ahead log so that WriteFrame (and,
+// transitively, BufferPool.FSync) cannot tear the backing store: every
+// write is appended to the log and fsync'd before it is applied to the
+// wrapped FramePool, and a crash between those two steps is repaired by
+// Recover on the next NewWALPool call.
+type WALPool struct {
+	backing        FramePool
+	logPath        string
+	checkpointPath string
+	log            *os.File
+	nextLSN        uint64
+	m              sync.Mutex
+}
+
+// NewWALPool opens (creating if necessary) the log file at logPath,
+// replays any records left over from an unclean shutdown into backing,
+// and returns a FramePool that logs future writes the same way. Replay
+// stops at the first record that fails its CRC check; everything after
+// that point is presumed to be a torn write from a crash mid-append and
+// is discarded.
+func NewWALPool(backing FramePool, logPath string) (*WALPool, error) {
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	wp := &WALPool{
+		backing:        backing,
+		logPath:        logPath,
+		checkpointPath: logPath + ".checkpoint",
+		log:            f,
+	}
+
+	if _, err := wp.Recover(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return wp, nil
+}
+
+// readCheckpoint returns the highest LSN known to have been fully applied
+// and fsync'd as of the last Checkpoint call, or 0 if no checkpoint has
+// ever been written.
+func (o *WALPool) readCheckpoint() (uint64, error) {
+	b, err := os.ReadFile(o.checkpointPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(b) != 8 {
+		return 0, fmt.Errorf("malformed checkpoint file %s: wanted 8 bytes, got %d", o.checkpointPath, len(b))
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// Recover scans the log from the last checkpoint forward, verifying CRCs
+// and redoing any record whose LSN exceeds the checkpoint. It returns the
+// LSNs it replayed, in order. Recover is called automatically by
+// NewWALPool; callers don't need to invoke it themselves.
+func (o *WALPool) Recover() ([]uint64, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	checkpoint, err := o.readCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := o.log.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var replayed []uint64
+	highest := checkpoint
+	for {
+		offset, err := o.log.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return replayed, err
+		}
+		rec, err := readWALRecord(o.log)
+		if err != nil {
+			// EOF (clean end of log) and a torn/corrupt trailing record both
+			// stop replay here; a torn write is indistinguishable from EOF
+			// until the next append overwrites it. Either way, truncate the
+			// log to the last good record's end offset: otherwise a torn
+			// tail left in place would still be there - and still be the
+			// first thing replay hits - on the next restart, silently
+			// discarding every valid record appended after it in the
+			// meantime.
+			if truncErr := o.log.Truncate(offset); truncErr != nil {
+				return replayed, truncErr
+			}
+			break
+		}
+		if rec.LSN > highest {
+			highest = rec.LSN
+		}
+		if rec.LSN <= checkpoint {
+			continue
+		}
+		if err := o.backing.WriteFrame(rec.FrameID, NewPageFrame(rec.Data)); err != nil {
+			return replayed, err
+		}
+		replayed = append(replayed, rec.LSN)
+	}
+
+	o.nextLSN = highest + 1
+
+	if _, err := o.log.Seek(0, io.SeekEnd); err != nil {
+		return replayed, err
+	}
+	return replayed, nil
+}
+
+// Checkpoint records the highest applied LSN and truncates the log, so
+// that a future Recover has nothing to redo. Call this after a successful
+// FSync.
+func (o *WALPool) Checkpoint() error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, o.nextLSN-1)
+	tmp := o.checkpointPath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, o.checkpointPath); err != nil {
+		return err
+	}
+
+	if err := o.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := o.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return o.log.Sync()
+}
+
+// Close releases the underlying log file handle.
+func (o *WALPool) Close() error {
+	return o.log.Close()
+}
+
+func (o *WALPool) AssessSize() (int, error) {
+	return o.backing.AssessSize()
+}
+
+func (o *WALPool) Size() int {
+	return o.backing.Size()
+}
+
+func (o *WALPool) ReadFrame(idx int) (*PageFrame, error) {
+	return o.backing.ReadFrame(idx)
+}
+
+func (o *WALPool) Falloc(n int) error {
+	return o.backing.Falloc(n)
+}
+
+// WriteFrame appends a record of the write to the log, fsyncs the log,
+// and only then applies the write to the backing FramePool.
+func (o *WALPool) WriteFrame(idx int, pf *PageFrame) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	rec := WALRecord{
+		LSN:     o.nextLSN,
+		FrameID: idx,
+		Data:    pf.DataClone(),
+	}
+	if err := writeWALRecord(o.log, rec); err != nil {
+		return err
+	}
+	if err := o.log.Sync(); err != nil {
+		return err
+	}
+	o.nextLSN++
+
+	return o.backing.WriteFrame(idx, pf)
+}
+
+func writeWALRecord(w io.Writer, rec WALRecord) error {
+	buf := new(bytes.Buffer)
+	buf.Grow(recordHeaderSize + len(rec.Data) + 4)
+	_ = binary.Write(buf, binary.BigEndian, rec.LSN)
+	_ = binary.Write(buf, binary.BigEndian, uint64(rec.FrameID))
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(rec.Data)))
+	buf.Write(rec.Data)
+	crc := crc32.ChecksumIEEE(buf.Bytes())
+	_ = binary.Write(buf, binary.BigEndian, crc)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readWALRecord(r io.Reader) (WALRecord, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return WALRecord{}, err
+	}
+	lsn := binary.BigEndian.Uint64(header[0:8])
+	frameID := int64(binary.BigEndian.Uint64(header[8:16]))
+	length := binary.BigEndian.Uint32(header[16:20])
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return WALRecord{}, fmt.Errorf("truncated WAL record at lsn %d: %w", lsn, err)
+	}
+
+	crcBytes := make([]byte, 4)
+	if _, err := io.ReadFull(r, crcBytes); err != nil {
+		return WALRecord{}, fmt.Errorf("truncated WAL record crc at lsn %d: %w", lsn, err)
+	}
+	wantCRC := binary.BigEndian.Uint32(crcBytes)
+	gotCRC := crc32.ChecksumIEEE(append(header, data...))
+	if wantCRC != gotCRC {
+		return WALRecord{}, fmt.Errorf("corrupt WAL record at lsn %d: crc mismatch", lsn)
+	}
+
+	return WALRecord{LSN: lsn, FrameID: int(frameID), Data: data}, nil
+}